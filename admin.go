@@ -0,0 +1,83 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/EntilZha/chapelco-weather-goajs/config"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// maxCalibrationBody is the largest calibration accepted by adminCalibrationsHandler, in bytes.
+const maxCalibrationBody = 1 << 20
+
+// configResponse is the effective configuration of the server, with secrets redacted, and where each setting came
+// from.
+type configResponse struct {
+	Config  *config.Config
+	Sources map[string]string
+}
+
+// adminOnly wraps a handler of an admin route, which requires the AdminToken as a bearer token. Without an AdminToken
+// admin routes are not found, so that they cannot be reached by guessing an empty token.
+func adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		h(w, r)
+	}
+}
+
+func adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := json.Marshal(configResponse{cfg.Redacted(), cfg.Sources()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// adminCalibrationsHandler registers the calibration in the JSON body of a POST, saving it to CalibrationsFile if that
+// is set so that it is applied again after a restart, and answers with all registered calibrations like
+// calibrationsHandler. Responses cached before then are not matched by conditional requests any more.
+func adminCalibrationsHandler(w http.ResponseWriter, r *http.Request) {
+	var c weather.Calibration
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxCalibrationBody)).Decode(&c); err != nil {
+		http.Error(w, "invalid calibration: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := weather.RegisterCalibration(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cfg.CalibrationsFile != "" {
+		if err := weather.SaveCalibration(cfg.CalibrationsFile, c); err != nil {
+			http.Error(w, "calibration applied but not saved: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	response, err := json.Marshal(weather.Calibrations())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
@@ -2,14 +2,28 @@ var chapelcoWeatherAppControllers = angular.module('chapelcoWeatherApp.controlle
 
 chapelcoWeatherAppControllers.controller('CurrentWeatherCtrl', ['$scope', '$http', function($scope, $http) {
 	$scope.dataLoaded = false;
-	$http.get('api/weather/current').success(function(data) {
+	var show = function(data) {
 		$scope.currentWeather = data;
 		$scope.dataLoaded = true;
+	};
+	if (!window.EventSource) {
+		$http.get('api/weather/current').success(show);
+		return;
+	}
+	// The stream starts with the current record and sends each new one; the browser reconnects and resumes on its own.
+	var source = new EventSource('api/weather/stream');
+	source.addEventListener('record', function(event) {
+		$scope.$apply(function() {
+			show(JSON.parse(event.data));
+		});
+	});
+	$scope.$on('$destroy', function() {
+		source.close();
 	});
 }]);
 
 chapelcoWeatherAppControllers.controller('WeatherChartsCtrl', ['$scope', '$http', function($scope, $http) {
-	$http.get('api/weather/past-field-lists/400').success(function(data) {
+	$http.get('api/weather/past-field-lists/400?sun=true').success(function(data) {
 		$scope.data = data;
 	});
 	options = {
@@ -31,6 +45,13 @@ chapelcoWeatherAppControllers.controller('WeatherChartsCtrl', ['$scope', '$http'
 		options.xAxis.title.text = 'Time';
 		options.xAxis.categories = $scope.data['DATE_TIME'];
 		options.xAxis.labels = { rotation: 45, step: 18 };
+		options.xAxis.plotBands = ($scope.data['SUN_BANDS'] || []).map(function(band) {
+			return {
+				from: band.From,
+				to: band.To,
+				color: band.Label == 'night' ? 'rgba(68, 85, 102, 0.15)' : 'rgba(68, 85, 102, 0.07)'
+			};
+		});
 		options.yAxis.title.text = yTitle;
 		options.series = [{
 			data: $scope.data[seriesName],
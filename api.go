@@ -0,0 +1,413 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/openapi"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+
+	"github.com/gorilla/mux"
+)
+
+// apiPrefix is where version 1 of the API is served.
+const apiPrefix = "/api/v1"
+
+// defaultLimit is the limit of list routes when none is given.
+const defaultLimit = 100
+
+// maxLimit is the largest limit accepted by list routes, which bounds the size of their responses. It is set from
+// APIMaxPageSize.
+var maxLimit = 10000
+
+// apiRoute is a GET route of version 1 of the API together with its description in the OpenAPI document. Response
+// is a value of the type the handler encodes.
+type apiRoute struct {
+	openapi.Operation
+	handler   http.HandlerFunc
+	cacheable bool
+}
+
+// Parameters shared by several routes.
+var (
+	limitParam  = openapi.QueryParam("limit", "integer", "How many items to return, 100 by default and at most the server's page size limit.")
+	rawParam    = openapi.QueryParam("raw", "boolean", "Return values as recorded, without calibration corrections.")
+	sinceParam  = openapi.QueryParam("since", "string", "RFC 3339 time or date in the station's timezone to start at.")
+	fieldsParam = openapi.QueryParam("fields", "string", "Comma separated field names or columns, all fields when empty.")
+	chartParams = []openapi.Parameter{
+		openapi.QueryParam("field", "string", "Field name or column to chart, Temperature by default."),
+		openapi.EnumParam("aggregation", "Aggregation level, raw by default.", weather.Aggregations...),
+		openapi.QueryParam("from", "string", "RFC 3339 time or date in the station's timezone to start at, two days before to by default."),
+		openapi.QueryParam("to", "string", "RFC 3339 time or date in the station's timezone to end before, now by default."),
+		openapi.QueryParam("area", "boolean", "Fill the area below the line."),
+		openapi.QueryParam("width", "integer", "Width in pixels, 800 by default."),
+		openapi.QueryParam("height", "integer", "Height in pixels, 400 by default."),
+		rawParam,
+	}
+)
+
+// apiRoutes returns the routes of version 1 of the API. Every resource is named in the plural and keyed by field
+// names, and lists are JSON arrays of objects.
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{openapi.Operation{
+			Path:    "/observations",
+			Summary: "A page of observations, oldest first",
+			Description: "Without cursor or from the page holds the latest observations. The Link header holds the " +
+				"URL of the next page, walking back in time or, from a time given by from, forward, and of the " +
+				"previous page. With fields only the selected fields are decoded and returned, as objects keyed by " +
+				"field name, which may include columns of the station's file listed by /fields?discovered=true.",
+			Tags: []string{"observations"},
+			Parameters: []openapi.Parameter{
+				limitParam,
+				openapi.QueryParam("cursor", "string", "Opaque cursor from a Link header."),
+				openapi.QueryParam("from", "string", "RFC 3339 time or date in the station's timezone to start at."),
+				fieldsParam,
+				rawParam,
+			},
+			Response: openapi.OneOf{[]weather.WeatherRecord{}, []map[string]interface{}{}},
+		}, apiObservationsHandler, true},
+		{openapi.Operation{
+			Path:       "/observations/current",
+			Summary:    "The latest observation",
+			Tags:       []string{"observations"},
+			Parameters: []openapi.Parameter{rawParam},
+			Response:   &weather.WeatherRecord{},
+		}, currentWeatherHandler, true},
+		{openapi.Operation{
+			Path:        "/observations/current/coded",
+			Summary:     "The latest observation as a coded bulletin",
+			Tags:        []string{"observations"},
+			Parameters:  []openapi.Parameter{openapi.EnumParam("format", "Bulletin format, synop by default.", "synop", "metar")},
+			ContentType: "text/plain",
+		}, currentCodedWeatherHandler, true},
+		{openapi.Operation{
+			Path:    "/observations/stream",
+			Summary: "New observations as Server-Sent Events",
+			Description: "Each event is named record, carries a WeatherRecord as data and its Datetime as id. Send " +
+				"Last-Event-ID to resume.",
+			Tags:        []string{"observations"},
+			ContentType: "text/event-stream",
+		}, streamHandler, false},
+		{openapi.Operation{
+			Path:    "/observations/subscribe",
+			Summary: "Aggregates of chosen fields over a WebSocket",
+			Description: "Upgrades to a WebSocket. Send {\"Channels\": [...], \"Aggregation\": \"hourly\"} to receive " +
+				"a snapshot followed by updates, both shaped as described here.",
+			Tags:     []string{"observations"},
+			Response: subscriptionMessage{},
+		}, subscriptionsHandler, false},
+		{openapi.Operation{
+			Path:    "/observations/export",
+			Summary: "Observations between two times as a file",
+			Tags:    []string{"observations"},
+			Parameters: []openapi.Parameter{
+				openapi.EnumParam("format", "File format, csv by default.", exportFormatNames()...),
+				fieldsParam,
+				openapi.QueryParam("from", "string", "RFC 3339 time or date in the station's timezone to start at."),
+				openapi.QueryParam("to", "string", "RFC 3339 time or date in the station's timezone to end before."),
+				openapi.QueryParam("delimiter", "string", "Value separator of the csv format."),
+				rawParam,
+			},
+			ContentType: "application/octet-stream",
+		}, exportHandler, true},
+		{openapi.Operation{
+			Path:    "/aggregates",
+			Summary: "Hourly or daily means of chosen fields",
+			Tags:    []string{"observations"},
+			Parameters: []openapi.Parameter{
+				fieldsParam,
+				openapi.EnumParam("aggregation", "Aggregation level, hourly by default.", weather.Aggregations...),
+				sinceParam,
+			},
+			Response: []weather.Aggregate{},
+		}, apiAggregatesHandler, true},
+		{openapi.Operation{
+			Path:        "/chart.svg",
+			Summary:     "Chart of one field as SVG",
+			Tags:        []string{"charts"},
+			Parameters:  chartParams,
+			ContentType: "image/svg+xml",
+		}, chartHandler, true},
+		{openapi.Operation{
+			Path:        "/chart.png",
+			Summary:     "Chart of one field as PNG",
+			Tags:        []string{"charts"},
+			Parameters:  chartParams,
+			ContentType: "image/png",
+		}, chartHandler, true},
+		{openapi.Operation{
+			Path:       "/daily-summaries",
+			Summary:    "Summaries of the most recent days, oldest first",
+			Tags:       []string{"summaries"},
+			Parameters: []openapi.Parameter{limitParam},
+			Response:   []weather.DailySummary{},
+		}, apiDailySummariesHandler, true},
+		{openapi.Operation{
+			Path:    "/reports/daily/{date}",
+			Summary: "Conditions report of a day and the following night",
+			Tags:    []string{"summaries"},
+			Parameters: []openapi.Parameter{
+				openapi.PathParam("date", "string", "Date in the station's timezone, today or yesterday."),
+				openapi.EnumParam("format", "Report format, html by default.", reportFormatNames()...),
+				openapi.QueryParam("lang", "string", "Language tag of the report, from Accept-Language by default."),
+			},
+			ContentType: "text/html",
+		}, reportHandler, true},
+		{openapi.Operation{
+			Path:       "/sun",
+			Summary:    "Sunrise, sunset and twilight",
+			Tags:       []string{"summaries"},
+			Parameters: []openapi.Parameter{openapi.QueryParam("date", "string", "Date in the station's timezone, today by default.")},
+			Response:   weather.SunTimes{},
+		}, sunHandler, true},
+		{openapi.Operation{
+			Path:       "/cloud-estimates",
+			Summary:    "Cloud cover estimated for the most recent observations",
+			Tags:       []string{"summaries"},
+			Parameters: []openapi.Parameter{limitParam},
+			Response:   []weather.CloudEstimate{},
+		}, apiCloudEstimatesHandler, true},
+		{openapi.Operation{
+			Path:     "/cloud-estimates/last-night",
+			Summary:  "Cloud cover estimated over the last night",
+			Tags:     []string{"summaries"},
+			Response: &weather.NightSky{},
+		}, lastNightSkyHandler, true},
+		{openapi.Operation{
+			Path:    "/anomalies",
+			Summary: "Readings flagged as sensor anomalies",
+			Tags:    []string{"quality"},
+			Parameters: []openapi.Parameter{
+				openapi.QueryParam("channel", "string", "Only return anomalies of this field name or column."),
+				sinceParam,
+			},
+			Response: []weather.Anomaly{},
+		}, apiAnomaliesHandler, true},
+		{openapi.Operation{
+			Path:     "/calibrations",
+			Summary:  "Calibration corrections applied to readings",
+			Tags:     []string{"quality"},
+			Response: []weather.Calibration{},
+		}, apiCalibrationsHandler, true},
+		{openapi.Operation{
+			Path:    "/fields",
+			Summary: "Fields of observations with their columns and units",
+			Tags:    []string{"meta"},
+			Parameters: []openapi.Parameter{
+				openapi.QueryParam("discovered", "boolean", "Also list the other numeric columns of the station's file."),
+			},
+			Response: []weather.Field{},
+		}, apiFieldsHandler, true},
+		{openapi.Operation{
+			Path:    "/openapi.json",
+			Summary: "This document",
+			Tags:    []string{"meta"},
+		}, apiDocumentHandler, false},
+	}
+}
+
+// apiDocument is the OpenAPI document of apiRoutes, built by buildAPIDocument.
+var apiDocument []byte
+
+// buildAPIDocument describes apiRoutes as an OpenAPI document, failing if a route's description does not match it.
+func buildAPIDocument() ([]byte, error) {
+	doc := openapi.NewDocument(openapi.Info{
+		Title:       "Chapelco Weather API",
+		Version:     "1.0.0",
+		Description: "Observations from the weather station at Chapelco Ski Resort. Times are RFC 3339, values in the units listed by /fields.",
+	}, apiPrefix)
+	for _, route := range apiRoutes() {
+		if err := doc.Add(route.Operation); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// registerAPIRoutes adds the routes of version 1 of the API to router.
+func registerAPIRoutes(router *mux.Router) {
+	var err error
+	if apiDocument, err = buildAPIDocument(); err != nil {
+		log.Fatal(err)
+	}
+	for _, route := range apiRoutes() {
+		handler := route.handler
+		if route.cacheable {
+			handler = cacheable(handler)
+		}
+		router.HandleFunc(apiPrefix+route.Path, handler).Methods("GET", "HEAD")
+	}
+}
+
+func apiDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(apiDocument)
+}
+
+func apiObservationsHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := limitRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cursor, err := cursorRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var records interface{}
+	var info weather.PageInfo
+	if list := r.FormValue("fields"); list != "" {
+		var fields []weather.Field
+		if fields, err = weather.ParseTableFields(list); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records, info, err = weather.ReadSparseRecordsPage(cursor.Datetime, cursor.Forward, n, fields, rawRequested(r))
+	} else {
+		records, info, err = weather.ReadRecordsPage(cursor.Datetime, cursor.Forward, n, rawRequested(r))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	setPageLinks(w, r, cursor, info)
+	writeJSON(w, records)
+}
+
+func apiAggregatesHandler(w http.ResponseWriter, r *http.Request) {
+	fields, err := weather.ParseFields(r.FormValue("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	aggregation := r.FormValue("aggregation")
+	if aggregation == "" {
+		aggregation = "hourly"
+	}
+	since, err := parseTimeParam(r, "since", time.Now().Add(-24*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !weather.ValidAggregation(aggregation) {
+		http.Error(w, localeRequested(r).T("error.unknown_aggregation", aggregation), http.StatusBadRequest)
+		return
+	}
+	aggregates, err := weather.ReadAggregates(fields[1:], aggregation, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, aggregates)
+}
+
+func apiDailySummariesHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := limitRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, weather.ReadLastNDailySummaries(n))
+}
+
+func apiCloudEstimatesHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := limitRequested(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, weather.ReadLastNCloudEstimates(n))
+}
+
+// apiAnomaliesHandler is anomaliesHandler with channels named by field name rather than column.
+func apiAnomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := parseTimeParam(r, "since", time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var column string
+	if channel := r.FormValue("channel"); channel != "" {
+		f, ok := weather.LookupField(channel)
+		if !ok {
+			http.Error(w, localeRequested(r).T("error.unknown_channel", channel), http.StatusBadRequest)
+			return
+		}
+		column = f.Column
+	}
+	anomalies := weather.Anomalies(column, since)
+	for i := range anomalies {
+		anomalies[i].Channel = fieldName(anomalies[i].Channel)
+	}
+	writeJSON(w, anomalies)
+}
+
+// apiCalibrationsHandler is calibrationsHandler with channels named by field name rather than column.
+func apiCalibrationsHandler(w http.ResponseWriter, r *http.Request) {
+	calibrations := weather.Calibrations()
+	for i := range calibrations {
+		calibrations[i].Channel = fieldName(calibrations[i].Channel)
+	}
+	writeJSON(w, calibrations)
+}
+
+// fieldName returns the name of the field keyed by column, or column itself if no field is.
+func fieldName(column string) string {
+	if f, ok := weather.LookupField(column); ok {
+		return f.Name
+	}
+	return column
+}
+
+func apiFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	if discovered, _ := strconv.ParseBool(r.FormValue("discovered")); discovered {
+		writeJSON(w, weather.DiscoverFields())
+		return
+	}
+	writeJSON(w, weather.Fields)
+}
+
+// limitRequested returns the limit parameter of r.
+func limitRequested(r *http.Request) (int, error) {
+	value := r.FormValue("limit")
+	if value == "" {
+		return defaultLimit, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxLimit {
+		return 0, errors.New(localeRequested(r).T("error.limit", maxLimit))
+	}
+	return n, nil
+}
+
+// exportFormatNames returns the names of weather.ExportFormats.
+func exportFormatNames() []string {
+	names := make([]string, 0, len(weather.ExportFormats))
+	for name := range weather.ExportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// cacheable wraps an API handler whose response only changes when the weather table is refreshed, a calibration is
+// registered or anomalies are recorded, and with the language it is written in. Responses carry an ETag built from
+// when the table was fetched, the Datetime of its latest record, when calibrations and anomalies last changed and the
+// locale requested, a Last-Modified of the latest of those changes and a Cache-Control max-age lasting until the next
+// refresh. While the anomaly detector is still scoring a refresh, responses must be revalidated instead. As the locale
+// may come from the Accept-Language header, responses vary on it. Conditional GET and HEAD requests that still
+// match get 304 Not Modified without running h.
+func cacheable(h http.HandlerFunc) http.HandlerFunc {
+	return cacheableFor(h, nil)
+}
+
+// cacheableFor is cacheable for a handler whose response also depends on the time of day, as when it defaults to
+// today. period returns when the response served at now was first due and when it is next due to change; its start is
+// added to the ETag and Last-Modified and its end bounds the max-age.
+func cacheableFor(h http.HandlerFunc, period func(now time.Time) (start, end time.Time)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			h(w, r)
+			return
+		}
+		state, err := weather.ReadCacheState()
+		if err != nil {
+			h(w, r)
+			return
+		}
+		now := time.Now()
+		expires := state.Expires
+		etag := `"` + strconv.FormatInt(state.UpdatedAt.UnixNano(), 36) + "-" + strconv.FormatInt(state.Latest.Unix(), 36)
+		lastModified := state.UpdatedAt
+		for _, changed := range []time.Time{state.CalibratedAt, state.DetectedAt} {
+			if !changed.IsZero() {
+				etag += "-" + strconv.FormatInt(changed.UnixNano(), 36)
+			}
+			if changed.After(lastModified) {
+				lastModified = changed
+			}
+		}
+		if period != nil {
+			start, end := period(now)
+			etag += "-" + strconv.FormatInt(start.Unix(), 36)
+			if start.After(lastModified) {
+				lastModified = start
+			}
+			if end.Before(expires) {
+				expires = end
+			}
+		}
+		etag += "-" + localeRequested(r).Tag + `"`
+		lastModified = lastModified.UTC().Truncate(time.Second)
+		maxAge := int(expires.Sub(now) / time.Second)
+		if maxAge < 0 || state.Detecting {
+			maxAge = 0
+		}
+		addVary(w.Header(), "Accept-Language")
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(maxAge))
+		if notModified(r, etag, lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		h(&uncachedErrors{ResponseWriter: w}, r)
+	}
+}
+
+// stationDay is the period of the calendar day at the station that now falls in.
+func stationDay(now time.Time) (time.Time, time.Time) {
+	y, m, d := now.In(weather.StationTimezone).Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, weather.StationTimezone)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// notModified reports whether the conditional headers of r match the current etag and lastModified. If-None-Match
+// takes precedence over If-Modified-Since as RFC 7232 requires.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, tag := range strings.Split(match, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !lastModified.After(since)
+}
+
+// addVary adds name to the Vary header unless it is already listed.
+func addVary(header http.Header, name string) {
+	if !headerLists(header, "Vary", name) {
+		header.Add("Vary", name)
+	}
+}
+
+// headerLists reports whether the comma separated header key lists token, ignoring case.
+func headerLists(header http.Header, key, token string) bool {
+	for _, value := range header[key] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uncachedErrors drops the caching headers set by cacheable from error responses so they are not kept by caches.
+type uncachedErrors struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *uncachedErrors) WriteHeader(code int) {
+	if !w.wroteHeader && code >= 400 {
+		for _, name := range []string{"ETag", "Last-Modified"} {
+			w.Header().Del(name)
+		}
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *uncachedErrors) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *uncachedErrors) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the wrapped ResponseWriter, so that an http.ResponseController can set deadlines on exports.
+func (w *uncachedErrors) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
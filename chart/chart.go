@@ -0,0 +1,303 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package chart draws time series line and area charts as SVG or PNG images without a browser. Both formats are
+// drawn by the same layout code onto a canvas, so they match apart from the fonts used.
+package chart
+
+import (
+	"errors"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+)
+
+// Default image size in pixels.
+const (
+	DefaultWidth  = 800
+	DefaultHeight = 400
+)
+
+// gapFactor is how many times the typical interval between points must pass without data for the line to break.
+const gapFactor = 3
+
+// Colors used by every chart, after the Highcharts defaults the web app uses.
+var (
+	backgroundColor = color.NRGBA{0xff, 0xff, 0xff, 0xff}
+	textColor       = color.NRGBA{0x33, 0x33, 0x33, 0xff}
+	axisColor       = color.NRGBA{0xc0, 0xd0, 0xe0, 0xff}
+	gridColor       = color.NRGBA{0xe6, 0xe6, 0xe6, 0xff}
+	zeroColor       = color.NRGBA{0x80, 0x80, 0x80, 0xff}
+	seriesColor     = color.NRGBA{0x7c, 0xb5, 0xec, 0xff}
+	areaColor       = color.NRGBA{0x7c, 0xb5, 0xec, 0x55}
+)
+
+// Chart is a time series to draw. Values that are NaN, and intervals much longer than usual between Times, break
+// the line. Area fills below the line. Times are labeled in Location, UTC when nil, and axis labels are formatted for
+// Locale, i18n.Default when nil.
+type Chart struct {
+	Title    string
+	XTitle   string
+	YTitle   string
+	Times    []time.Time
+	Values   []float64
+	Area     bool
+	Width    int
+	Height   int
+	Location *time.Location
+	Locale   *i18n.Locale
+}
+
+// ErrNoData is returned when a chart has no values to draw.
+var ErrNoData = errors.New("chart: no data")
+
+// canvas is what charts are drawn on. Coordinates are in pixels from the top left corner.
+type canvas interface {
+	line(x1, y1, x2, y2 float64, c color.NRGBA, width float64)
+	polygon(points []point, c color.NRGBA)
+	// text draws s with its anchor, "start", "middle" or "end", at x and its baseline at y, rotated a quarter turn
+	// counterclockwise when vertical is set.
+	text(x, y float64, s string, anchor string, size float64, vertical bool)
+}
+
+type point struct {
+	x, y float64
+}
+
+// layout holds the plot area and scales of a chart being drawn.
+type layout struct {
+	left, top, right, bottom float64
+	minTime, maxTime         time.Time
+	minValue, maxValue       float64
+}
+
+func (l *layout) x(t time.Time) float64 {
+	span := l.maxTime.Sub(l.minTime)
+	if span <= 0 {
+		return (l.left + l.right) / 2
+	}
+	return l.left + float64(t.Sub(l.minTime))/float64(span)*(l.right-l.left)
+}
+
+func (l *layout) y(v float64) float64 {
+	return l.bottom - (v-l.minValue)/(l.maxValue-l.minValue)*(l.bottom-l.top)
+}
+
+// size returns the width and height of c, applying the defaults.
+func (c *Chart) size() (int, int) {
+	width, height := c.Width, c.Height
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	if height <= 0 {
+		height = DefaultHeight
+	}
+	return width, height
+}
+
+// draw draws c on cv.
+func (c *Chart) draw(cv canvas) error {
+	if len(c.Times) != len(c.Values) {
+		return errors.New("chart: " + strconv.Itoa(len(c.Times)) + " times for " + strconv.Itoa(len(c.Values)) + " values")
+	}
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+	for _, v := range c.Values {
+		if !math.IsNaN(v) {
+			minValue, maxValue = math.Min(minValue, v), math.Max(maxValue, v)
+		}
+	}
+	if math.IsInf(minValue, 1) {
+		return ErrNoData
+	}
+	if c.Area {
+		// Areas are filled down to zero, so zero must be in range.
+		minValue, maxValue = math.Min(minValue, 0), math.Max(maxValue, 0)
+	}
+	width, height := c.size()
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	step, ticks := niceTicks(minValue, maxValue, 6)
+	l := &layout{
+		left: 75, top: 45, right: float64(width) - 25, bottom: float64(height) - 70,
+		minTime: c.Times[0], maxTime: c.Times[len(c.Times)-1],
+		minValue: ticks[0], maxValue: ticks[len(ticks)-1],
+	}
+	cv.text(float64(width)/2, 25, c.Title, "middle", 16, false)
+	cv.text(20, (l.top+l.bottom)/2, c.YTitle, "middle", 12, true)
+	cv.text((l.left+l.right)/2, float64(height)-12, c.XTitle, "middle", 12, false)
+	lang := c.Locale
+	if lang == nil {
+		lang = i18n.Default
+	}
+	for _, v := range ticks {
+		y := l.y(v)
+		cv.line(l.left, y, l.right, y, gridColor, 1)
+		cv.text(l.left-8, y+4, formatTick(v, step, lang), "end", 11, false)
+	}
+	if l.minValue < 0 && l.maxValue > 0 {
+		cv.line(l.left, l.y(0), l.right, l.y(0), zeroColor, 1)
+	}
+	cv.line(l.left, l.bottom, l.right, l.bottom, axisColor, 1)
+	for _, t := range timeTicks(l.minTime, l.maxTime, loc, lang, int((l.right-l.left)/90)) {
+		x := l.x(t.time)
+		cv.line(x, l.bottom, x, l.bottom+5, axisColor, 1)
+		cv.text(x, l.bottom+20, t.label, "middle", 11, false)
+	}
+	for _, segment := range c.segments() {
+		points := make([]point, 0, len(segment)+2)
+		for _, i := range segment {
+			points = append(points, point{l.x(c.Times[i]), l.y(c.Values[i])})
+		}
+		if c.Area {
+			base := l.y(0)
+			area := append([]point{{points[0].x, base}}, points...)
+			cv.polygon(append(area, point{points[len(points)-1].x, base}), areaColor)
+		}
+		if len(points) == 1 {
+			cv.line(points[0].x-1, points[0].y, points[0].x+1, points[0].y, seriesColor, 2)
+		}
+		for i := 1; i < len(points); i++ {
+			cv.line(points[i-1].x, points[i-1].y, points[i].x, points[i].y, seriesColor, 2)
+		}
+	}
+	return nil
+}
+
+// segments returns the indexes of the runs of points drawn as unbroken lines.
+func (c *Chart) segments() [][]int {
+	var intervals []float64
+	for i := 1; i < len(c.Times); i++ {
+		intervals = append(intervals, float64(c.Times[i].Sub(c.Times[i-1])))
+	}
+	maxGap := math.Inf(1)
+	if len(intervals) > 0 {
+		sort.Float64s(intervals)
+		maxGap = gapFactor * intervals[len(intervals)/2]
+	}
+	var segments [][]int
+	var current []int
+	for i, v := range c.Values {
+		if math.IsNaN(v) || (len(current) > 0 && float64(c.Times[i].Sub(c.Times[current[len(current)-1]])) > maxGap) {
+			if len(current) > 0 {
+				segments = append(segments, current)
+			}
+			current = nil
+			if math.IsNaN(v) {
+				continue
+			}
+		}
+		current = append(current, i)
+	}
+	if len(current) > 0 {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+// niceTicks returns the step and values of about n evenly spaced round ticks covering min to max.
+func niceTicks(min, max float64, n int) (float64, []float64) {
+	if max-min < 1e-9 {
+		min, max = min-1, max+1
+	}
+	raw := (max - min) / float64(n)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := magnitude
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*magnitude >= raw {
+			step = m * magnitude
+			break
+		}
+	}
+	var ticks []float64
+	for v := math.Floor(min/step) * step; v < max+step/2; v += step {
+		ticks = append(ticks, v)
+	}
+	if ticks[len(ticks)-1] < max {
+		ticks = append(ticks, ticks[len(ticks)-1]+step)
+	}
+	return step, ticks
+}
+
+// formatTick formats a tick value in lang with as many decimals as its step needs.
+func formatTick(v, step float64, lang *i18n.Locale) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+		if step*math.Pow(10, float64(decimals)) != math.Floor(step*math.Pow(10, float64(decimals))) {
+			decimals++
+		}
+	}
+	if math.Abs(v) < step/1e6 {
+		v = 0
+	}
+	return lang.Number(v, decimals)
+}
+
+// timeTick is a labeled tick on the time axis.
+type timeTick struct {
+	time  time.Time
+	label string
+}
+
+// tickIntervals are the candidate spacings of time ticks.
+var tickIntervals = []time.Duration{
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 2 * 24 * time.Hour, 7 * 24 * time.Hour, 14 * 24 * time.Hour, 28 * 24 * time.Hour,
+}
+
+// timeTicks returns at most n ticks between from and to aligned to whole hours or local midnights in loc, labeled
+// with the dates and times of lang.
+func timeTicks(from, to time.Time, loc *time.Location, lang *i18n.Locale, n int) []timeTick {
+	if n < 2 {
+		n = 2
+	}
+	interval := tickIntervals[len(tickIntervals)-1]
+	for _, candidate := range tickIntervals {
+		if to.Sub(from)/candidate < time.Duration(n) {
+			interval = candidate
+			break
+		}
+	}
+	local := from.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	label := lang.Time
+	if interval >= 24*time.Hour {
+		label = lang.DayMonth
+	} else if to.Sub(from) > 24*time.Hour {
+		label = func(t time.Time) string { return lang.DayMonth(t) + " " + lang.Time(t) }
+	}
+	var ticks []timeTick
+	for t := start; !t.After(to); t = t.Add(interval) {
+		if !t.Before(from) {
+			ticks = append(ticks, timeTick{t, label(t.In(loc))})
+		}
+	}
+	return ticks
+}
+
+// SVG writes c as an SVG image to w.
+func (c *Chart) SVG(w io.Writer) error {
+	width, height := c.size()
+	cv := newSVGCanvas(width, height)
+	if err := c.draw(cv); err != nil {
+		return err
+	}
+	return cv.writeTo(w)
+}
+
+// PNG writes c as a PNG image to w.
+func (c *Chart) PNG(w io.Writer) error {
+	width, height := c.size()
+	cv := newRasterCanvas(width, height)
+	if err := c.draw(cv); err != nil {
+		return err
+	}
+	return cv.encode(w)
+}
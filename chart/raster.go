@@ -0,0 +1,134 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package chart
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+)
+
+// rasterCanvas draws a chart on an image, antialiasing lines and writing text with the built in bitmap font.
+type rasterCanvas struct {
+	img *image.RGBA
+}
+
+func newRasterCanvas(width, height int) *rasterCanvas {
+	cv := &rasterCanvas{image.NewRGBA(image.Rect(0, 0, width, height))}
+	for i := 0; i < len(cv.img.Pix); i += 4 {
+		cv.img.Pix[i], cv.img.Pix[i+1], cv.img.Pix[i+2], cv.img.Pix[i+3] =
+			backgroundColor.R, backgroundColor.G, backgroundColor.B, 0xff
+	}
+	return cv
+}
+
+// blend paints c over pixel x, y with the given coverage from 0 to 1.
+func (cv *rasterCanvas) blend(x, y int, c color.NRGBA, coverage float64) {
+	if !(image.Point{x, y}.In(cv.img.Rect)) || coverage <= 0 {
+		return
+	}
+	alpha := math.Min(coverage, 1) * float64(c.A) / 0xff
+	i := cv.img.PixOffset(x, y)
+	pix := cv.img.Pix[i : i+3]
+	for j, v := range []uint8{c.R, c.G, c.B} {
+		pix[j] = uint8(float64(v)*alpha + float64(pix[j])*(1-alpha) + 0.5)
+	}
+}
+
+// line draws a segment with round caps, shading each pixel by how much of it the stroke covers.
+func (cv *rasterCanvas) line(x1, y1, x2, y2 float64, c color.NRGBA, width float64) {
+	r := width / 2
+	minX, maxX := int(math.Floor(math.Min(x1, x2)-r-1)), int(math.Ceil(math.Max(x1, x2)+r+1))
+	minY, maxY := int(math.Floor(math.Min(y1, y2)-r-1)), int(math.Ceil(math.Max(y1, y2)+r+1))
+	dx, dy := x2-x1, y2-y1
+	length2 := dx*dx + dy*dy
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			// Distance from the pixel center to the nearest point of the segment.
+			px, py := float64(x)+0.5, float64(y)+0.5
+			t := 0.0
+			if length2 > 0 {
+				t = math.Max(0, math.Min(1, ((px-x1)*dx+(py-y1)*dy)/length2))
+			}
+			d := math.Hypot(px-(x1+t*dx), py-(y1+t*dy))
+			cv.blend(x, y, c, r+0.5-d)
+		}
+	}
+}
+
+// polygon fills points with the even-odd rule, sampling each pixel at its center.
+func (cv *rasterCanvas) polygon(points []point, c color.NRGBA) {
+	if len(points) < 3 {
+		return
+	}
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		minY, maxY = math.Min(minY, p.y), math.Max(maxY, p.y)
+	}
+	var crossings []float64
+	for y := int(math.Floor(minY)); y <= int(math.Ceil(maxY)); y++ {
+		py := float64(y) + 0.5
+		crossings = crossings[:0]
+		for i := range points {
+			a, b := points[i], points[(i+1)%len(points)]
+			if (a.y <= py) != (b.y <= py) {
+				crossings = append(crossings, a.x+(py-a.y)/(b.y-a.y)*(b.x-a.x))
+			}
+		}
+		sort.Float64s(crossings)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			for x := int(math.Ceil(crossings[i] - 0.5)); float64(x)+0.5 <= crossings[i+1]; x++ {
+				cv.blend(x, y, c, 1)
+			}
+		}
+	}
+}
+
+func (cv *rasterCanvas) text(x, y float64, s string, anchor string, size float64, vertical bool) {
+	scale := int(size/8 + 0.5)
+	if scale < 1 {
+		scale = 1
+	}
+	glyphs := []rune(s)
+	width := float64(len(glyphs)*glyphAdvance*scale - scale)
+	// u runs along the text and v down across it, from the start of the baseline.
+	u0 := 0.0
+	switch anchor {
+	case "middle":
+		u0 = -width / 2
+	case "end":
+		u0 = -width
+	}
+	for i, r := range glyphs {
+		columns, ok := font[r]
+		if !ok {
+			columns = font['?']
+		}
+		for col, bits := range columns {
+			for row := 0; row < glyphHeight; row++ {
+				if bits&(1<<uint(row)) == 0 {
+					continue
+				}
+				for sy := 0; sy < scale; sy++ {
+					for sx := 0; sx < scale; sx++ {
+						u := u0 + float64((i*glyphAdvance+col)*scale+sx)
+						v := float64((row-glyphHeight)*scale + sy)
+						if vertical {
+							cv.blend(int(x+v), int(y-u), textColor, 1)
+						} else {
+							cv.blend(int(x+u), int(y+v), textColor, 1)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func (cv *rasterCanvas) encode(w io.Writer) error {
+	return png.Encode(w, cv.img)
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// svgCanvas draws a chart as SVG elements.
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	cv := new(svgCanvas)
+	fmt.Fprintf(&cv.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" `+
+		`font-family="Lucida Grande, Lucida Sans Unicode, Arial, Helvetica, sans-serif">`+"\n", width, height, width, height)
+	fmt.Fprintf(&cv.buf, `<rect width="%d" height="%d" fill="%s"/>`+"\n", width, height, svgColor(backgroundColor))
+	return cv
+}
+
+func (cv *svgCanvas) line(x1, y1, x2, y2 float64, c color.NRGBA, width float64) {
+	fmt.Fprintf(&cv.buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%g"`+
+		` stroke-linecap="round"%s/>`+"\n", x1, y1, x2, y2, svgColor(c), width, svgOpacity("stroke", c))
+}
+
+func (cv *svgCanvas) polygon(points []point, c color.NRGBA) {
+	coordinates := make([]string, len(points))
+	for i, p := range points {
+		coordinates[i] = fmt.Sprintf("%.1f,%.1f", p.x, p.y)
+	}
+	fmt.Fprintf(&cv.buf, `<polygon points="%s" fill="%s"%s/>`+"\n", strings.Join(coordinates, " "), svgColor(c),
+		svgOpacity("fill", c))
+}
+
+func (cv *svgCanvas) text(x, y float64, s string, anchor string, size float64, vertical bool) {
+	transform := ""
+	if vertical {
+		transform = fmt.Sprintf(` transform="rotate(-90 %.1f %.1f)"`, x, y)
+	}
+	fmt.Fprintf(&cv.buf, `<text x="%.1f" y="%.1f" text-anchor="%s" font-size="%g" fill="%s"%s>`, x, y, anchor, size,
+		svgColor(textColor), transform)
+	xml.EscapeText(&cv.buf, []byte(s))
+	cv.buf.WriteString("</text>\n")
+}
+
+func (cv *svgCanvas) writeTo(w io.Writer) error {
+	cv.buf.WriteString("</svg>\n")
+	_, err := cv.buf.WriteTo(w)
+	return err
+}
+
+// svgColor returns the opaque part of c as a hex color.
+func svgColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// svgOpacity returns the attribute making property translucent when c is, or nothing when it is opaque.
+func svgOpacity(property string, c color.NRGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+	return fmt.Sprintf(` %s-opacity="%.2f"`, property, float64(c.A)/0xff)
+}
@@ -0,0 +1,118 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/chart"
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// maxChartSize bounds the width and height of rendered charts in pixels.
+const maxChartSize = 4000
+
+// chartHandler renders a chart of one field as SVG or PNG, by the extension of the route.
+func chartHandler(w http.ResponseWriter, r *http.Request) {
+	loc := localeRequested(r)
+	c, err := chartRequested(r, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Language", loc.Tag)
+	if strings.HasSuffix(r.URL.Path, ".png") {
+		w.Header().Set("Content-Type", "image/png")
+		err = c.PNG(w)
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = c.SVG(w)
+	}
+	if err == chart.ErrNoData {
+		http.Error(w, loc.T("error.no_data"), http.StatusNotFound)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// chartRequested builds the chart asked for by the field, aggregation, from, to, area, width and height parameters
+// of r, titled in loc. By default it charts the temperature over the last two days.
+func chartRequested(r *http.Request, loc *i18n.Locale) (*chart.Chart, error) {
+	name := r.FormValue("field")
+	if name == "" {
+		name = "Temperature"
+	}
+	fields, err := weather.ParseTableFields(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 {
+		return nil, errors.New(loc.T("error.chart_datetime"))
+	}
+	f := fields[1]
+	to, err := parseTimeParam(r, "to", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	from, err := parseTimeParam(r, "from", to.Add(-48*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	c := &chart.Chart{XTitle: loc.T("chart.time"), Location: weather.StationTimezone, Locale: loc}
+	if c.Width, err = sizeParam(r, loc, "width", chart.DefaultWidth); err != nil {
+		return nil, err
+	}
+	if c.Height, err = sizeParam(r, loc, "height", chart.DefaultHeight); err != nil {
+		return nil, err
+	}
+	c.Area, _ = strconv.ParseBool(r.FormValue("area"))
+	// Fields without titles of their own, such as discovered columns, are titled after their name.
+	noun, key := f.Name, "chart."+f.Column
+	c.Title, c.YTitle = loc.T("chart.past", noun), f.Label()
+	if loc.Has(key + ".title") {
+		noun, c.Title, c.YTitle = loc.T(key+".noun"), loc.T(key+".title"), loc.T(key+".axis")
+	}
+	aggregation := r.FormValue("aggregation")
+	if aggregation == "" || aggregation == "raw" {
+		c.Times, c.Values, err = weather.ReadSeries(f, from, to, rawRequested(r))
+		return c, err
+	}
+	if !weather.ValidAggregation(aggregation) {
+		return nil, errors.New(loc.T("error.unknown_aggregation", aggregation))
+	}
+	if f.Discovered() {
+		return nil, errors.New(loc.T("error.discovered_aggregation"))
+	}
+	aggregates, err := weather.ReadAggregates([]weather.Field{f}, aggregation, from)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range aggregates {
+		if !a.Datetime.Before(to) {
+			break
+		}
+		c.Times = append(c.Times, a.Datetime)
+		c.Values = append(c.Values, a.Values[f.Name])
+	}
+	c.Title = loc.T("chart."+aggregation, noun)
+	return c, nil
+}
+
+// sizeParam parses the form value name as a size in pixels, returning def if it is empty.
+func sizeParam(r *http.Request, loc *i18n.Locale, name string, def int) (int, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return def, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 100 || size > maxChartSize {
+		return 0, errors.New(loc.T("error.chart_size", name, maxChartSize))
+	}
+	return size, nil
+}
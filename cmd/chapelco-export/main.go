@@ -0,0 +1,80 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Command chapelco-export downloads the Chapelco weather station data and writes it in one of the export formats
+//
+//	chapelco-export -format parquet -from 2014-06-01 -to 2014-10-01 -o season.parquet
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+func main() {
+	format := flag.String("format", "csv", "export format: csv, tsv, ndjson, line, parquet or arrow")
+	fromFlag := flag.String("from", "", "first time to export, as a date or RFC 3339 time (default: start of data)")
+	toFlag := flag.String("to", "", "time to export up to, as a date or RFC 3339 time (default: end of data)")
+	fields := flag.String("fields", "", "comma separated fields to export (default: all)")
+	delimiter := flag.String("delimiter", ",", "value delimiter for the csv format")
+	raw := flag.Bool("raw", false, "export values without calibration corrections")
+	output := flag.String("o", "", "file to write to (default: standard output)")
+	flag.StringVar(&weather.DataURL, "data-url", weather.DataURL, "HTTP URL or path of the station's DBF file")
+	flag.StringVar(&weather.DataEncoding, "data-encoding", weather.DataEncoding, "character encoding of the DBF file")
+	flag.Float64Var(&weather.StationElevation, "station-elevation", weather.StationElevation,
+		"station height above sea level in m")
+	flag.Parse()
+
+	exportFormat, ok := weather.ExportFormats[*format]
+	if !ok {
+		log.Fatalf("unknown export format %q", *format)
+	}
+	selected, err := weather.ParseFields(*fields)
+	if err != nil {
+		log.Fatal(err)
+	}
+	from, to := time.Time{}, time.Now().Add(24*time.Hour)
+	if *fromFlag != "" {
+		if from, err = weather.ParseTime(*fromFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *toFlag != "" {
+		if to, err = weather.ParseTime(*toFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if d := []rune(*delimiter); len(d) != 1 || !weather.ValidDelimiter(d[0]) {
+		log.Fatal("delimiter must be a single character other than a quote or a line break")
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			log.Fatal(err)
+		}
+	}
+	w := bufio.NewWriter(out)
+	if exportFormat.Columnar {
+		err = weather.ExportColumns(*format, w, from, to, selected, *raw)
+	} else {
+		var enc weather.RecordEncoder
+		if enc, err = weather.NewRecordEncoder(*format, w, []rune(*delimiter)[0]); err == nil {
+			err = weather.ExportRecords(enc, from, to, selected, *raw)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
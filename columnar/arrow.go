@@ -0,0 +1,151 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package columnar
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Arrow IPC enum values used by the writer, from Schema.fbs and Message.fbs.
+const (
+	arrowMetadataV5         = 4
+	arrowHeaderSchema       = 1
+	arrowHeaderRecordBatch  = 3
+	arrowTypeFloatingPoint  = 3
+	arrowTypeTimestamp      = 10
+	arrowPrecisionDouble    = 2
+	arrowUnitMillisecond    = 1
+	arrowContinuationMarker = 0xffffffff
+)
+
+// arrowWriter writes an Arrow IPC stream: the schema message followed by one record batch message per batch.
+type arrowWriter struct {
+	w      io.Writer
+	schema []ColumnSpec
+}
+
+// NewArrowWriter returns a BatchWriter writing an Arrow IPC stream with schema to w.
+func NewArrowWriter(w io.Writer, schema []ColumnSpec) (BatchWriter, error) {
+	aw := &arrowWriter{w: w, schema: schema}
+	if err := aw.writeMessage(aw.schemaMessage(), nil); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (aw *arrowWriter) WriteBatch(columns []Column) error {
+	rows, err := batchRows(aw.schema, columns)
+	if err != nil {
+		return err
+	}
+	// Columns have no nulls, so each gets an empty validity buffer followed by its values.
+	body := make([]byte, 8*rows*len(columns))
+	nodes := make([][2]int64, len(columns))
+	buffers := make([][2]int64, 0, 2*len(columns))
+	for i, spec := range aw.schema {
+		offset := 8 * rows * i
+		for j := 0; j < rows; j++ {
+			if spec.Type == Timestamp {
+				binary.LittleEndian.PutUint64(body[offset+8*j:], uint64(columns[i].Int64s[j]))
+			} else {
+				binary.LittleEndian.PutUint64(body[offset+8*j:], math.Float64bits(columns[i].Float64s[j]))
+			}
+		}
+		nodes[i] = [2]int64{int64(rows), 0}
+		buffers = append(buffers, [2]int64{int64(offset), 0}, [2]int64{int64(offset), int64(8 * rows)})
+	}
+	b := new(fbBuilder)
+	buffersVector := b.createStructVector(buffers)
+	nodesVector := b.createStructVector(nodes)
+	b.startTable()
+	b.addInt64(0, int64(rows))
+	b.addOffset(1, nodesVector)
+	b.addOffset(2, buffersVector)
+	batch := b.endTable()
+	return aw.writeMessage(aw.message(b, arrowHeaderRecordBatch, batch, int64(len(body))), body)
+}
+
+// Close writes the end of stream marker.
+func (aw *arrowWriter) Close() error {
+	eos := make([]byte, 8)
+	binary.LittleEndian.PutUint32(eos, arrowContinuationMarker)
+	_, err := aw.w.Write(eos)
+	return err
+}
+
+// schemaMessage builds the Schema message describing every column as a non nullable field.
+func (aw *arrowWriter) schemaMessage() []byte {
+	b := new(fbBuilder)
+	fields := make([]int, len(aw.schema))
+	for i, spec := range aw.schema {
+		name := b.createString(spec.Name)
+		var metadata int
+		if spec.Unit != "" {
+			key := b.createString("unit")
+			value := b.createString(spec.Unit)
+			b.startTable()
+			b.addOffset(0, key)
+			b.addOffset(1, value)
+			metadata = b.createOffsetVector([]int{b.endTable()})
+		}
+		var typ int
+		var typeType uint8
+		if spec.Type == Timestamp {
+			timezone := b.createString("UTC")
+			b.startTable()
+			b.addUint16(0, arrowUnitMillisecond)
+			b.addOffset(1, timezone)
+			typ, typeType = b.endTable(), arrowTypeTimestamp
+		} else {
+			b.startTable()
+			b.addUint16(0, arrowPrecisionDouble)
+			typ, typeType = b.endTable(), arrowTypeFloatingPoint
+		}
+		children := b.createOffsetVector(nil)
+		b.startTable()
+		b.addOffset(0, name)
+		b.addUint8(1, 0)
+		b.addUint8(2, typeType)
+		b.addOffset(3, typ)
+		b.addOffset(5, children)
+		if metadata != 0 {
+			b.addOffset(6, metadata)
+		}
+		fields[i] = b.endTable()
+	}
+	fieldsVector := b.createOffsetVector(fields)
+	b.startTable()
+	b.addUint16(0, 0)
+	b.addOffset(1, fieldsVector)
+	schema := b.endTable()
+	return aw.message(b, arrowHeaderSchema, schema, 0)
+}
+
+// message wraps header in a Message table and finishes b.
+func (aw *arrowWriter) message(b *fbBuilder, headerType uint8, header int, bodyLength int64) []byte {
+	b.startTable()
+	b.addInt64(3, bodyLength)
+	b.addOffset(2, header)
+	b.addUint16(0, arrowMetadataV5)
+	b.addUint8(1, headerType)
+	return b.finish(b.endTable())
+}
+
+// writeMessage writes the encapsulated message: continuation marker, padded metadata length, metadata and body.
+func (aw *arrowWriter) writeMessage(metadata, body []byte) error {
+	padded := (len(metadata) + 7) &^ 7
+	prefix := make([]byte, 8)
+	binary.LittleEndian.PutUint32(prefix, arrowContinuationMarker)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(padded))
+	if _, err := aw.w.Write(prefix); err != nil {
+		return err
+	}
+	if _, err := aw.w.Write(append(metadata, make([]byte, padded-len(metadata))...)); err != nil {
+		return err
+	}
+	_, err := aw.w.Write(body)
+	return err
+}
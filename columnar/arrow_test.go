@@ -0,0 +1,336 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// fbTable reads a FlatBuffers table independently of fbBuilder, following the FlatBuffers binary format. It is checked
+// against a stream written by Apache Arrow in TestArrowReference, so that the writer is checked against the format
+// rather than against a reading of it shared with the writer.
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+// fbRoot returns the root table of the FlatBuffer buf.
+func fbRoot(buf []byte) fbTable {
+	return fbTable{buf, int(binary.LittleEndian.Uint32(buf))}
+}
+
+// field returns the position of the field in slot, or 0 if it is absent.
+func (t fbTable) field(slot int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	entry := 4 + 2*slot
+	if entry >= int(binary.LittleEndian.Uint16(t.buf[vtable:])) {
+		return 0
+	}
+	if off := int(binary.LittleEndian.Uint16(t.buf[vtable+entry:])); off != 0 {
+		return t.pos + off
+	}
+	return 0
+}
+
+func (t fbTable) uint8(slot int) uint8 {
+	if p := t.field(slot); p != 0 {
+		return t.buf[p]
+	}
+	return 0
+}
+
+func (t fbTable) uint16(slot int) uint16 {
+	if p := t.field(slot); p != 0 {
+		return binary.LittleEndian.Uint16(t.buf[p:])
+	}
+	return 0
+}
+
+func (t fbTable) int64(slot int) int64 {
+	if p := t.field(slot); p != 0 {
+		if p%8 != 0 {
+			panic("flatbuffers: misaligned int64")
+		}
+		return int64(binary.LittleEndian.Uint64(t.buf[p:]))
+	}
+	return 0
+}
+
+// ref follows the offset in slot, returning the position it points to or 0 if the field is absent.
+func (t fbTable) ref(slot int) int {
+	if p := t.field(slot); p != 0 {
+		return p + int(binary.LittleEndian.Uint32(t.buf[p:]))
+	}
+	return 0
+}
+
+func (t fbTable) table(slot int) fbTable {
+	return fbTable{t.buf, t.ref(slot)}
+}
+
+func (t fbTable) string(slot int) string {
+	p := t.ref(slot)
+	if p == 0 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint32(t.buf[p:]))
+	if t.buf[p+4+n] != 0 {
+		panic("flatbuffers: string is not zero terminated")
+	}
+	return string(t.buf[p+4 : p+4+n])
+}
+
+// tables returns the tables of the vector of tables in slot.
+func (t fbTable) tables(slot int) []fbTable {
+	p := t.ref(slot)
+	if p == 0 {
+		return nil
+	}
+	tables := make([]fbTable, binary.LittleEndian.Uint32(t.buf[p:]))
+	for i := range tables {
+		e := p + 4 + 4*i
+		tables[i] = fbTable{t.buf, e + int(binary.LittleEndian.Uint32(t.buf[e:]))}
+	}
+	return tables
+}
+
+// pairs returns the structs of two int64s in the vector in slot, as Arrow's FieldNode and Buffer are.
+func (t fbTable) pairs(slot int) [][2]int64 {
+	p := t.ref(slot)
+	if p == 0 {
+		return nil
+	}
+	if (p+4)%8 != 0 {
+		panic("flatbuffers: misaligned struct vector")
+	}
+	pairs := make([][2]int64, binary.LittleEndian.Uint32(t.buf[p:]))
+	for i := range pairs {
+		e := p + 4 + 16*i
+		pairs[i] = [2]int64{int64(binary.LittleEndian.Uint64(t.buf[e:])), int64(binary.LittleEndian.Uint64(t.buf[e+8:]))}
+	}
+	return pairs
+}
+
+// arrowMessage is an encapsulated Arrow IPC message: its Message table and body.
+type arrowMessage struct {
+	header fbTable
+	body   []byte
+}
+
+// readArrowStream splits an Arrow IPC stream into its messages, checking the framing and end of stream marker.
+func readArrowStream(t *testing.T, data []byte) []arrowMessage {
+	var messages []arrowMessage
+	for {
+		if len(data) < 8 || binary.LittleEndian.Uint32(data) != arrowContinuationMarker {
+			t.Fatalf("message does not start with a continuation marker: % x", data)
+		}
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		if size == 0 {
+			if len(data) != 8 {
+				t.Fatalf("%d bytes after the end of stream marker", len(data)-8)
+			}
+			return messages
+		}
+		if size%8 != 0 {
+			t.Fatalf("metadata of %d bytes is not padded to 8 bytes", size)
+		}
+		metadata := data[8 : 8+size]
+		message := fbRoot(metadata)
+		if version := message.uint16(0); version != arrowMetadataV5 {
+			t.Fatalf("metadata version %d, want V5", version)
+		}
+		bodyLength := int(message.int64(3))
+		messages = append(messages, arrowMessage{message, data[8+size : 8+size+bodyLength]})
+		data = data[8+size+bodyLength:]
+	}
+}
+
+func TestArrowRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewArrowWriter(&buf, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := [][]Column{
+		{{Int64s: []int64{1404172799000, 1404173999000}}, {Float64s: []float64{-2, -2.5}}},
+		{{Int64s: []int64{1404175199000}}, {Float64s: []float64{math.NaN()}}},
+	}
+	for _, batch := range batches {
+		if err := w.WriteBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := readArrowStream(t, buf.Bytes())
+	if len(messages) != 3 {
+		t.Fatalf("%d messages, want a schema and 2 record batches", len(messages))
+	}
+	if typ := messages[0].header.uint8(1); typ != arrowHeaderSchema {
+		t.Fatalf("first message has header type %d, want Schema", typ)
+	}
+	fields := messages[0].header.table(2).tables(1)
+	if len(fields) != 2 {
+		t.Fatalf("schema has %d fields, want 2", len(fields))
+	}
+	datetime, temperature := fields[0], fields[1]
+	if datetime.string(0) != "Datetime" || datetime.uint8(1) != 0 || datetime.uint8(2) != arrowTypeTimestamp {
+		t.Errorf("first field is %q of type %d", datetime.string(0), datetime.uint8(2))
+	}
+	if ts := datetime.table(3); ts.uint16(0) != arrowUnitMillisecond || ts.string(1) != "UTC" {
+		t.Errorf("timestamp type has unit %d and timezone %q", ts.uint16(0), ts.string(1))
+	}
+	if temperature.string(0) != "Temperature" || temperature.uint8(2) != arrowTypeFloatingPoint ||
+		temperature.table(3).uint16(0) != arrowPrecisionDouble {
+		t.Errorf("second field is %q of type %d", temperature.string(0), temperature.uint8(2))
+	}
+	if metadata := datetime.tables(6); len(metadata) != 0 {
+		t.Errorf("Datetime has %d metadata entries, want none", len(metadata))
+	}
+	if metadata := temperature.tables(6); len(metadata) != 1 || metadata[0].string(0) != "unit" ||
+		metadata[0].string(1) != "°C" {
+		t.Errorf("Temperature metadata %v", metadata)
+	}
+
+	var datetimes []int64
+	var temperatures []float64
+	for i, m := range messages[1:] {
+		if typ := m.header.uint8(1); typ != arrowHeaderRecordBatch {
+			t.Fatalf("message %d has header type %d, want RecordBatch", i+1, typ)
+		}
+		batch := m.header.table(2)
+		rows := batch.int64(0)
+		if want := int64(len(batches[i][0].Int64s)); rows != want {
+			t.Errorf("batch %d has %d rows, want %d", i, rows, want)
+		}
+		if nodes := batch.pairs(1); !reflect.DeepEqual(nodes, [][2]int64{{rows, 0}, {rows, 0}}) {
+			t.Errorf("batch %d field nodes %v", i, nodes)
+		}
+		buffers := batch.pairs(2)
+		if len(buffers) != 4 {
+			t.Fatalf("batch %d has %d buffers, want a validity and a data buffer per column", i, len(buffers))
+		}
+		for c := 0; c < 2; c++ {
+			validity, values := buffers[2*c], buffers[2*c+1]
+			if validity[1] != 0 || values[0]%8 != 0 || values[1] != 8*rows {
+				t.Errorf("batch %d column %d buffers %v %v", i, c, validity, values)
+			}
+			for j := int64(0); j < rows; j++ {
+				v := binary.LittleEndian.Uint64(m.body[values[0]+8*j:])
+				if c == 0 {
+					datetimes = append(datetimes, int64(v))
+				} else {
+					temperatures = append(temperatures, math.Float64frombits(v))
+				}
+			}
+		}
+	}
+	if want := []int64{1404172799000, 1404173999000, 1404175199000}; !reflect.DeepEqual(datetimes, want) {
+		t.Errorf("Datetime column %v, want %v", datetimes, want)
+	}
+	if len(temperatures) != 3 || temperatures[0] != -2 || temperatures[1] != -2.5 || !math.IsNaN(temperatures[2]) {
+		t.Errorf("Temperature column %v, want [-2 -2.5 NaN]", temperatures)
+	}
+}
+
+func TestArrowEmptyStream(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewArrowWriter(&buf, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if messages := readArrowStream(t, buf.Bytes()); len(messages) != 1 {
+		t.Errorf("%d messages, want only the schema", len(messages))
+	}
+}
+
+// goldenBatches are the batches written to the golden files in testdata.
+var goldenBatches = [][]Column{
+	{{Int64s: []int64{1404172799000, 1404173999000}}, {Float64s: []float64{-2, -2.5}}},
+	{{Int64s: []int64{}}, {Float64s: []float64{}}},
+	{{Int64s: []int64{1404175199000}}, {Float64s: []float64{3.25}}},
+}
+
+// TestArrowReference reads testdata/reference.arrow, the rows of goldenBatches with a schema like testSchema written
+// by the IPC writer of the Apache Arrow Go module (github.com/apache/arrow/go/arrow v0.0.0-20211112161151), which
+// skips the empty batch. Reading it back checks that readArrowStream and fbTable follow Arrow rather than the writer.
+func TestArrowReference(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/reference.arrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := readArrowStream(t, data)
+	if len(messages) != 3 || messages[0].header.uint8(1) != arrowHeaderSchema {
+		t.Fatalf("%d messages, want a schema and 2 record batches", len(messages))
+	}
+	fields := messages[0].header.table(2).tables(1)
+	if len(fields) != 2 || fields[0].string(0) != "Datetime" || fields[1].string(0) != "Temperature" {
+		t.Fatalf("schema fields %v", fields)
+	}
+	if fields[0].uint8(2) != arrowTypeTimestamp || fields[0].table(3).uint16(0) != arrowUnitMillisecond ||
+		fields[0].table(3).string(1) != "UTC" {
+		t.Errorf("Datetime has type %d", fields[0].uint8(2))
+	}
+	if fields[1].uint8(2) != arrowTypeFloatingPoint || fields[1].table(3).uint16(0) != arrowPrecisionDouble {
+		t.Errorf("Temperature has type %d", fields[1].uint8(2))
+	}
+	if metadata := fields[1].tables(6); len(metadata) != 1 || metadata[0].string(0) != "unit" ||
+		metadata[0].string(1) != "°C" {
+		t.Errorf("Temperature metadata %v", metadata)
+	}
+	var datetimes []int64
+	var temperatures []float64
+	for _, m := range messages[1:] {
+		batch := m.header.table(2)
+		buffers := batch.pairs(2)
+		if len(buffers) != 4 {
+			t.Fatalf("%d buffers, want 4", len(buffers))
+		}
+		for j := int64(0); j < batch.int64(0); j++ {
+			datetimes = append(datetimes, int64(binary.LittleEndian.Uint64(m.body[buffers[1][0]+8*j:])))
+			temperatures = append(temperatures, math.Float64frombits(binary.LittleEndian.Uint64(m.body[buffers[3][0]+8*j:])))
+		}
+	}
+	if want := []int64{1404172799000, 1404173999000, 1404175199000}; !reflect.DeepEqual(datetimes, want) {
+		t.Errorf("Datetime column %v, want %v", datetimes, want)
+	}
+	if want := []float64{-2, -2.5, 3.25}; !reflect.DeepEqual(temperatures, want) {
+		t.Errorf("Temperature column %v, want %v", temperatures, want)
+	}
+}
+
+// TestArrowGolden checks the writer still produces testdata/weather.arrow for goldenBatches. That stream was read
+// back with the IPC reader of the Apache Arrow Go module, which found the schema, metadata and values written.
+func TestArrowGolden(t *testing.T) {
+	golden, err := ioutil.ReadFile("testdata/weather.arrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := NewArrowWriter(&buf, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range goldenBatches {
+		if err := w.WriteBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden) {
+		t.Errorf("stream differs from testdata/weather.arrow:\n% x\nwant\n% x", buf.Bytes(), golden)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Writes typed columns of data as Parquet files and Arrow IPC streams without external dependencies
+package columnar
+
+import "errors"
+
+// ColumnType is the physical type of the values in a Column.
+type ColumnType int
+
+// Column types supported by the writers.
+const (
+	// Timestamp columns hold milliseconds since the Unix epoch in UTC.
+	Timestamp ColumnType = iota
+	Float64
+)
+
+// ColumnSpec describes a column of a schema. Unit is stored as column metadata when it is not empty.
+type ColumnSpec struct {
+	Name string
+	Type ColumnType
+	Unit string
+}
+
+// Column holds one batch of values for a ColumnSpec. Timestamp columns use Int64s and Float64 columns use Float64s.
+type Column struct {
+	Int64s   []int64
+	Float64s []float64
+}
+
+// BatchWriter writes batches of columns that all share one schema. The columns of a batch are given in schema order
+// and must all have the same length. Close must be called after the last batch to complete the output.
+type BatchWriter interface {
+	WriteBatch(columns []Column) error
+	Close() error
+}
+
+// ErrBatchShape is returned by WriteBatch when a batch does not match the schema.
+var ErrBatchShape = errors.New("columnar: batch does not match schema")
+
+// Len returns the number of values in c.
+func (c Column) Len() int {
+	if c.Int64s != nil {
+		return len(c.Int64s)
+	}
+	return len(c.Float64s)
+}
+
+// batchRows checks columns against schema and returns the number of rows in the batch.
+func batchRows(schema []ColumnSpec, columns []Column) (int, error) {
+	if len(columns) != len(schema) {
+		return 0, ErrBatchShape
+	}
+	rows := -1
+	for i, c := range columns {
+		n := len(c.Float64s)
+		if schema[i].Type == Timestamp {
+			n = len(c.Int64s)
+		}
+		if rows >= 0 && n != rows {
+			return 0, ErrBatchShape
+		}
+		rows = n
+	}
+	if rows < 0 {
+		rows = 0
+	}
+	return rows, nil
+}
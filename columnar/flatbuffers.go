@@ -0,0 +1,150 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package columnar
+
+import "encoding/binary"
+
+// fbBuilder builds a FlatBuffer back to front, the way the reference builder does. Offsets are measured from the end
+// of the buffer, so they stay valid as more is prepended.
+type fbBuilder struct {
+	buf      []byte
+	minAlign int
+	fields   map[int]int
+	start    int
+}
+
+// offset returns the current offset from the end of the buffer.
+func (b *fbBuilder) offset() int {
+	return len(b.buf)
+}
+
+func (b *fbBuilder) prepend(p []byte) {
+	b.buf = append(append(make([]byte, 0, len(p)+len(b.buf)), p...), b.buf...)
+}
+
+// prep pads the buffer so that after additional more bytes it is aligned to size.
+func (b *fbBuilder) prep(size, additional int) {
+	if size > b.minAlign {
+		b.minAlign = size
+	}
+	pad := (-(len(b.buf) + additional)) & (size - 1)
+	b.prepend(make([]byte, pad))
+}
+
+func (b *fbBuilder) prependUint8(x uint8) {
+	b.prep(1, 0)
+	b.prepend([]byte{x})
+}
+
+func (b *fbBuilder) prependUint16(x uint16) {
+	b.prep(2, 0)
+	p := make([]byte, 2)
+	binary.LittleEndian.PutUint16(p, x)
+	b.prepend(p)
+}
+
+func (b *fbBuilder) prependUint32(x uint32) {
+	b.prep(4, 0)
+	p := make([]byte, 4)
+	binary.LittleEndian.PutUint32(p, x)
+	b.prepend(p)
+}
+
+func (b *fbBuilder) prependInt64(x int64) {
+	b.prep(8, 0)
+	p := make([]byte, 8)
+	binary.LittleEndian.PutUint64(p, uint64(x))
+	b.prepend(p)
+}
+
+// prependOffset prepends a reference to the object at off.
+func (b *fbBuilder) prependOffset(off int) {
+	b.prep(4, 0)
+	b.prependUint32(uint32(b.offset() + 4 - off))
+}
+
+func (b *fbBuilder) createString(s string) int {
+	b.prep(4, len(s)+1)
+	b.prepend(append([]byte(s), 0))
+	b.prependUint32(uint32(len(s)))
+	return b.offset()
+}
+
+// createOffsetVector creates a vector referencing the objects at offsets.
+func (b *fbBuilder) createOffsetVector(offsets []int) int {
+	b.prep(4, 4*len(offsets))
+	for i := len(offsets) - 1; i >= 0; i-- {
+		b.prependOffset(offsets[i])
+	}
+	b.prependUint32(uint32(len(offsets)))
+	return b.offset()
+}
+
+// createStructVector creates a vector of structs made of pairs of int64, such as Arrow's FieldNode and Buffer.
+func (b *fbBuilder) createStructVector(pairs [][2]int64) int {
+	b.prep(4, 16*len(pairs))
+	b.prep(8, 16*len(pairs))
+	for i := len(pairs) - 1; i >= 0; i-- {
+		b.prependInt64(pairs[i][1])
+		b.prependInt64(pairs[i][0])
+	}
+	b.prependUint32(uint32(len(pairs)))
+	return b.offset()
+}
+
+func (b *fbBuilder) startTable() {
+	b.fields = make(map[int]int)
+	b.start = b.offset()
+}
+
+func (b *fbBuilder) addUint8(slot int, x uint8) {
+	b.prependUint8(x)
+	b.fields[slot] = b.offset()
+}
+
+func (b *fbBuilder) addUint16(slot int, x uint16) {
+	b.prependUint16(x)
+	b.fields[slot] = b.offset()
+}
+
+func (b *fbBuilder) addInt64(slot int, x int64) {
+	b.prependInt64(x)
+	b.fields[slot] = b.offset()
+}
+
+func (b *fbBuilder) addOffset(slot int, off int) {
+	b.prependOffset(off)
+	b.fields[slot] = b.offset()
+}
+
+// endTable writes the vtable for the table being built and returns the table's offset.
+func (b *fbBuilder) endTable() int {
+	b.prependUint32(0)
+	object := b.offset()
+	slots := 0
+	for slot := range b.fields {
+		if slot+1 > slots {
+			slots = slot + 1
+		}
+	}
+	for slot := slots - 1; slot >= 0; slot-- {
+		var field uint16
+		if off, ok := b.fields[slot]; ok {
+			field = uint16(object - off)
+		}
+		b.prependUint16(field)
+	}
+	b.prependUint16(uint16(object - b.start))
+	b.prependUint16(uint16(4 + 2*slots))
+	vtable := b.offset()
+	binary.LittleEndian.PutUint32(b.buf[len(b.buf)-object:], uint32(vtable-object))
+	return object
+}
+
+// finish prepends the root table reference and returns the finished buffer.
+func (b *fbBuilder) finish(root int) []byte {
+	b.prep(b.minAlign, 4)
+	b.prependOffset(root)
+	return b.buf
+}
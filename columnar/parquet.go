@@ -0,0 +1,193 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package columnar
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// parquetMagic starts and ends every Parquet file.
+const parquetMagic = "PAR1"
+
+// Parquet enum values used by the writer.
+const (
+	parquetInt64           = 2
+	parquetDouble          = 5
+	parquetRequired        = 0
+	parquetPlain           = 0
+	parquetRLE             = 3
+	parquetUncompressed    = 0
+	parquetDataPage        = 0
+	parquetTimestampMillis = 9
+)
+
+// parquetWriter writes each batch as a row group of uncompressed, plain encoded, required columns with a single data
+// page per column.
+type parquetWriter struct {
+	w         io.Writer
+	schema    []ColumnSpec
+	offset    int64
+	rows      int64
+	rowGroups []parquetRowGroup
+}
+
+// parquetRowGroup records where the column chunks of a written row group are.
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+type parquetChunk struct {
+	offset int64
+	size   int64
+}
+
+// NewParquetWriter returns a BatchWriter writing a Parquet file with schema to w.
+func NewParquetWriter(w io.Writer, schema []ColumnSpec) (BatchWriter, error) {
+	pw := &parquetWriter{w: w, schema: schema}
+	if err := pw.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) WriteBatch(columns []Column) error {
+	rows, err := batchRows(pw.schema, columns)
+	if err != nil || rows == 0 {
+		return err
+	}
+	group := parquetRowGroup{rows: int64(rows)}
+	for i, spec := range pw.schema {
+		data := make([]byte, 8*rows)
+		for j := 0; j < rows; j++ {
+			if spec.Type == Timestamp {
+				binary.LittleEndian.PutUint64(data[8*j:], uint64(columns[i].Int64s[j]))
+			} else {
+				binary.LittleEndian.PutUint64(data[8*j:], math.Float64bits(columns[i].Float64s[j]))
+			}
+		}
+		header := new(compactWriter)
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.beginStruct(5)
+		header.i32(1, int32(rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+		header.endStruct()
+		chunk := parquetChunk{offset: pw.offset, size: int64(len(header.buf) + len(data))}
+		if err := pw.write(header.buf); err != nil {
+			return err
+		}
+		if err := pw.write(data); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+	}
+	pw.rows += int64(rows)
+	pw.rowGroups = append(pw.rowGroups, group)
+	return nil
+}
+
+// Close writes the file metadata footer.
+func (pw *parquetWriter) Close() error {
+	meta := new(compactWriter)
+	meta.i32(1, 1)
+	meta.list(2, thriftStruct, len(pw.schema)+1)
+	meta.beginStruct(0)
+	meta.string(4, "schema")
+	meta.i32(5, int32(len(pw.schema)))
+	meta.endStruct()
+	for _, spec := range pw.schema {
+		meta.beginStruct(0)
+		meta.i32(1, pw.physicalType(spec))
+		meta.i32(3, parquetRequired)
+		meta.string(4, spec.Name)
+		if spec.Type == Timestamp {
+			meta.i32(6, parquetTimestampMillis)
+			// LogicalType union holding TIMESTAMP(isAdjustedToUTC=true, unit=MILLIS).
+			meta.beginStruct(10)
+			meta.beginStruct(8)
+			meta.bool(1, true)
+			meta.beginStruct(2)
+			meta.beginStruct(1)
+			meta.endStruct()
+			meta.endStruct()
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.endStruct()
+	}
+	meta.i64(3, pw.rows)
+	meta.list(4, thriftStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		meta.beginStruct(0)
+		meta.list(1, thriftStruct, len(group.chunks))
+		var size int64
+		for i, chunk := range group.chunks {
+			size += chunk.size
+			meta.beginStruct(0)
+			meta.i64(2, chunk.offset)
+			meta.beginStruct(3)
+			meta.i32(1, pw.physicalType(pw.schema[i]))
+			meta.list(2, thriftI32, 1)
+			meta.varint(parquetPlain)
+			meta.list(3, thriftBinary, 1)
+			meta.rawString(pw.schema[i].Name)
+			meta.i32(4, parquetUncompressed)
+			meta.i64(5, group.rows)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.endStruct()
+			meta.endStruct()
+		}
+		meta.i64(2, size)
+		meta.i64(3, group.rows)
+		meta.endStruct()
+	}
+	var units []ColumnSpec
+	for _, spec := range pw.schema {
+		if spec.Unit != "" {
+			units = append(units, spec)
+		}
+	}
+	if len(units) > 0 {
+		meta.list(5, thriftStruct, len(units))
+		for _, spec := range units {
+			meta.beginStruct(0)
+			meta.string(1, spec.Name+".unit")
+			meta.string(2, spec.Unit)
+			meta.endStruct()
+		}
+	}
+	meta.string(6, "chapelco-weather-goajs")
+	meta.endStruct()
+	footer := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footer, uint32(len(meta.buf)))
+	if err := pw.write(meta.buf); err != nil {
+		return err
+	}
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	return pw.write([]byte(parquetMagic))
+}
+
+func (pw *parquetWriter) physicalType(spec ColumnSpec) int32 {
+	if spec.Type == Timestamp {
+		return parquetInt64
+	}
+	return parquetDouble
+}
@@ -0,0 +1,281 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftStructValue is a Thrift struct decoded without its IDL, its field values keyed by field id.
+type thriftStructValue map[int]interface{}
+
+// compactReader decodes the Thrift compact protocol independently of compactWriter, following the protocol
+// specification, so that the writer is checked against the format rather than against itself.
+type compactReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *compactReader) byte() byte {
+	if r.pos >= len(r.buf) {
+		panic("thrift: unexpected end of data")
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *compactReader) uvarint() uint64 {
+	x, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		panic("thrift: invalid varint")
+	}
+	r.pos += n
+	return x
+}
+
+func (r *compactReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int8(r.byte())
+	case 4, 5, 6:
+		return r.varint()
+	case 7:
+		x := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return x
+	case 8:
+		n := int(r.uvarint())
+		s := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case 9, 10:
+		header := r.byte()
+		size, elem := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			if elem == 1 || elem == 2 {
+				list[i] = r.byte() == 1
+			} else {
+				list[i] = r.value(elem)
+			}
+		}
+		return list
+	case 12:
+		return r.structValue()
+	}
+	panic(fmt.Sprintf("thrift: unsupported type %d", typ))
+}
+
+func (r *compactReader) structValue() thriftStructValue {
+	fields := make(thriftStructValue)
+	id := 0
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0f
+		if delta := int(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int(r.varint())
+		}
+		fields[id] = r.value(typ)
+	}
+}
+
+// parquetFile is a Parquet file read back with compactReader.
+type parquetFile struct {
+	meta    thriftStructValue
+	columns map[string][]uint64
+}
+
+// readParquet checks the framing of data and reads its metadata and the values of every column chunk, which the
+// writer stores as plain encoded 8 byte values.
+func readParquet(t *testing.T, data []byte) *parquetFile {
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("file is not framed by PAR1: % x", data)
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &compactReader{buf: data[len(data)-8-size : len(data)-8]}
+	f := &parquetFile{meta: footer.structValue(), columns: make(map[string][]uint64)}
+	if footer.pos != size {
+		t.Fatalf("metadata is %d bytes, footer says %d", footer.pos, size)
+	}
+	for _, g := range f.meta[4].([]interface{}) {
+		group := g.(thriftStructValue)
+		for _, c := range group[1].([]interface{}) {
+			chunk := c.(thriftStructValue)
+			meta := chunk[3].(thriftStructValue)
+			name := meta[3].([]interface{})[0].(string)
+			offset := int(meta[9].(int64))
+			page := &compactReader{buf: data, pos: offset}
+			header := page.structValue()
+			if header[1].(int64) != parquetDataPage {
+				t.Fatalf("column %s: page type %v, want a data page", name, header[1])
+			}
+			length := int(header[3].(int64))
+			if end := page.pos + length; int64(end-offset) != meta[7].(int64) {
+				t.Fatalf("column %s: chunk is %d bytes, metadata says %v", name, end-offset, meta[7])
+			}
+			rows := int(header[5].(thriftStructValue)[1].(int64))
+			if int64(rows) != group[3].(int64) || 8*rows != length {
+				t.Fatalf("column %s: %d values in %d bytes for a row group of %v rows", name, rows, length, group[3])
+			}
+			for i := 0; i < rows; i++ {
+				v := binary.LittleEndian.Uint64(data[page.pos+8*i:])
+				f.columns[name] = append(f.columns[name], v)
+			}
+		}
+	}
+	return f
+}
+
+var testSchema = []ColumnSpec{
+	{Name: "Datetime", Type: Timestamp},
+	{Name: "Temperature", Type: Float64, Unit: "°C"},
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewParquetWriter(&buf, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := [][]Column{
+		{{Int64s: []int64{1404172799000, 1404173999000}}, {Float64s: []float64{-2, -2.5}}},
+		{{Int64s: []int64{}}, {Float64s: []float64{}}},
+		{{Int64s: []int64{1404175199000}}, {Float64s: []float64{math.Inf(-1)}}},
+	}
+	for _, batch := range batches {
+		if err := w.WriteBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := readParquet(t, buf.Bytes())
+	if f.meta[1] != int64(1) || f.meta[3] != int64(3) {
+		t.Errorf("version %v and rows %v, want 1 and 3", f.meta[1], f.meta[3])
+	}
+	if groups := f.meta[4].([]interface{}); len(groups) != 2 {
+		t.Errorf("%d row groups, want 2 as empty batches are skipped", len(groups))
+	}
+	schema := f.meta[2].([]interface{})
+	root := schema[0].(thriftStructValue)
+	if root[4] != "schema" || root[5] != int64(2) {
+		t.Errorf("root schema element %v", root)
+	}
+	for i, want := range []struct {
+		name      string
+		physical  int64
+		converted interface{}
+	}{{"Datetime", parquetInt64, int64(parquetTimestampMillis)}, {"Temperature", parquetDouble, nil}} {
+		element := schema[i+1].(thriftStructValue)
+		if element[4] != want.name || element[1] != want.physical || element[3] != int64(parquetRequired) ||
+			element[6] != want.converted {
+			t.Errorf("schema element %d is %v, want %s", i+1, element, want.name)
+		}
+	}
+	timestamp := schema[1].(thriftStructValue)[10].(thriftStructValue)[8].(thriftStructValue)
+	if timestamp[1] != true {
+		t.Errorf("timestamp is not adjusted to UTC: %v", timestamp)
+	}
+	if _, ok := timestamp[2].(thriftStructValue)[1]; !ok {
+		t.Errorf("timestamp unit is not MILLIS: %v", timestamp)
+	}
+	metadata := f.meta[5].([]interface{})
+	if len(metadata) != 1 || !reflect.DeepEqual(metadata[0], thriftStructValue{1: "Temperature.unit", 2: "°C"}) {
+		t.Errorf("key value metadata %v", metadata)
+	}
+
+	var datetimes []int64
+	for _, v := range f.columns["Datetime"] {
+		datetimes = append(datetimes, int64(v))
+	}
+	if want := []int64{1404172799000, 1404173999000, 1404175199000}; !reflect.DeepEqual(datetimes, want) {
+		t.Errorf("Datetime column %v, want %v", datetimes, want)
+	}
+	var temperatures []float64
+	for _, v := range f.columns["Temperature"] {
+		temperatures = append(temperatures, math.Float64frombits(v))
+	}
+	if want := []float64{-2, -2.5, math.Inf(-1)}; !reflect.DeepEqual(temperatures, want) {
+		t.Errorf("Temperature column %v, want %v", temperatures, want)
+	}
+}
+
+func TestParquetBatchShape(t *testing.T) {
+	w, err := NewParquetWriter(new(bytes.Buffer), testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, batch := range [][]Column{
+		{{Int64s: []int64{1}}},
+		{{Int64s: []int64{1, 2}}, {Float64s: []float64{1}}},
+	} {
+		if err := w.WriteBatch(batch); err != ErrBatchShape {
+			t.Errorf("WriteBatch(%v) = %v, want ErrBatchShape", batch, err)
+		}
+	}
+}
+
+func TestCompactWriter(t *testing.T) {
+	w := new(compactWriter)
+	w.i32(1, -1)
+	w.i64(20, math.MinInt64)
+	w.bool(21, false)
+	w.string(22, "")
+	w.list(23, thriftI32, 20)
+	for i := 0; i < 20; i++ {
+		w.varint(int64(i - 10))
+	}
+	w.beginStruct(40)
+	w.i32(1, math.MaxInt32)
+	w.endStruct()
+	w.bool(41, true)
+	w.endStruct()
+
+	r := &compactReader{buf: w.buf}
+	got := r.structValue()
+	var list []interface{}
+	for i := 0; i < 20; i++ {
+		list = append(list, int64(i-10))
+	}
+	want := thriftStructValue{
+		1:  int64(-1),
+		20: int64(math.MinInt64),
+		21: false,
+		22: "",
+		23: list,
+		40: thriftStructValue{1: int64(math.MaxInt32)},
+		41: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+	if r.pos != len(w.buf) {
+		t.Errorf("decoded %d of %d bytes", r.pos, len(w.buf))
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package columnar
+
+import "encoding/binary"
+
+// Thrift compact protocol type codes.
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// compactWriter encodes Parquet metadata with the Thrift compact protocol. Fields must be written in increasing id
+// order within each struct.
+type compactWriter struct {
+	buf     []byte
+	lastIDs []int
+	lastID  int
+}
+
+func (w *compactWriter) fieldHeader(id int, typ byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta<<4)|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(int64(id))
+	}
+	w.lastID = id
+}
+
+// varint appends x zigzag encoded.
+func (w *compactWriter) varint(x int64) {
+	w.uvarint(uint64((x << 1) ^ (x >> 63)))
+}
+
+func (w *compactWriter) uvarint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], x)]...)
+}
+
+func (w *compactWriter) i32(id int, x int32) {
+	w.fieldHeader(id, thriftI32)
+	w.varint(int64(x))
+}
+
+func (w *compactWriter) i64(id int, x int64) {
+	w.fieldHeader(id, thriftI64)
+	w.varint(x)
+}
+
+func (w *compactWriter) bool(id int, x bool) {
+	if x {
+		w.fieldHeader(id, thriftTrue)
+	} else {
+		w.fieldHeader(id, thriftFalse)
+	}
+}
+
+func (w *compactWriter) string(id int, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.rawString(s)
+}
+
+func (w *compactWriter) rawString(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// beginStruct starts a struct valued field. id 0 begins a struct that is a list element.
+func (w *compactWriter) beginStruct(id int) {
+	if id > 0 {
+		w.fieldHeader(id, thriftStruct)
+	}
+	w.lastIDs = append(w.lastIDs, w.lastID)
+	w.lastID = 0
+}
+
+// endStruct ends the innermost struct, or the top level struct being written when none is open.
+func (w *compactWriter) endStruct() {
+	w.buf = append(w.buf, 0)
+	if len(w.lastIDs) > 0 {
+		w.lastID = w.lastIDs[len(w.lastIDs)-1]
+		w.lastIDs = w.lastIDs[:len(w.lastIDs)-1]
+	}
+}
+
+// list starts a list valued field of size elements of type elem. Elements follow directly.
+func (w *compactWriter) list(id int, elem byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf = append(w.buf, byte(size<<4)|elem)
+	} else {
+		w.buf = append(w.buf, 0xf0|elem)
+		w.uvarint(uint64(size))
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package config loads the settings of the server. Each setting has a default, which a JSON config file, then an
+// environment variable and then a command line flag can override, so a deployment can keep most settings in a file
+// and still change one for a single run. The file is named by the -config flag or the CONFIG_FILE variable and holds
+// an object keyed by the names of the fields of Config.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.google.com/p/mahonia"
+)
+
+// Sources of a setting, from the lowest precedence to the highest.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// redacted replaces the values of secret settings when they are shown.
+const redacted = "REDACTED"
+
+// Config holds every setting of the server. The env tag of a field names its environment variable and the flag tag
+// its command line flag. Fields tagged secret are hidden by Redacted, all of their value or, for addresses tagged
+// secret:"url", only the credentials and query they may hold.
+type Config struct {
+	Port             string   `env:"PORT" flag:"port" help:"TCP port to listen on"`
+	PublicURL        string   `env:"PUBLIC_URL" flag:"public-url" secret:"url" help:"URL of the server, for links"`
+	DataURL          string   `env:"DATA_URL" flag:"data-url" secret:"url" help:"HTTP URL or path of the DBF file"`
+	DataEncoding     string   `env:"DATA_ENCODING" flag:"data-encoding" help:"character encoding of the DBF file"`
+	CacheTTL         Duration `env:"CACHE_TTL" flag:"cache-ttl" help:"how long the DBF file is cached"`
+	RefreshInterval  Duration `env:"REFRESH_INTERVAL" flag:"refresh-interval" help:"how often to look for new data"`
+	Timezone         string   `env:"TIMEZONE" flag:"timezone" help:"logger timezone, a name or offset like -04:00"`
+	StationElevation float64  `env:"STATION_ELEVATION" flag:"station-elevation" help:"station height above sea level in m"`
+	StaticDir        string   `env:"STATIC_DIR" flag:"static-dir" help:"directory of the web app"`
+	TemplatesDir     string   `env:"TEMPLATES_DIR" flag:"templates-dir" help:"directory of the page and report templates"`
+	APIMaxPageSize   int      `env:"API_MAX_PAGE_SIZE" flag:"api-max-page-size" help:"largest limit of list routes"`
+	AdminToken       string   `env:"ADMIN_TOKEN" flag:"admin-token" secret:"true" help:"token of the admin routes"`
+	WebSocketOrigins string   `env:"WEBSOCKET_ORIGINS" flag:"websocket-origins" help:"other origins allowed to subscribe"`
+	ReadTimeout      Duration `env:"READ_TIMEOUT" flag:"read-timeout" help:"longest time to read a request"`
+	WriteTimeout     Duration `env:"WRITE_TIMEOUT" flag:"write-timeout" help:"longest time to write a response"`
+	IdleTimeout      Duration `env:"IDLE_TIMEOUT" flag:"idle-timeout" help:"how long idle connections are kept open"`
+	ShutdownTimeout  Duration `env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" help:"how long to drain requests on exit"`
+
+	CalibrationsFile string `env:"CALIBRATIONS_FILE" flag:"calibrations-file" help:"JSON file of sensor calibrations"`
+
+	WUStationID       string `env:"WU_STATION_ID" flag:"wu-station-id" help:"Weather Underground station ID"`
+	WUURL             string `env:"WU_URL" flag:"wu-url" secret:"url" help:"Weather Underground upload endpoint"`
+	WUPassword        string `env:"WU_PASSWORD" flag:"wu-password" secret:"true" help:"Weather Underground password"`
+	CWOPCallsign      string `env:"CWOP_CALLSIGN" flag:"cwop-callsign" help:"CWOP callsign"`
+	CWOPServer        string `env:"CWOP_SERVER" flag:"cwop-server" help:"CWOP APRS-IS server"`
+	CWOPPasscode      string `env:"CWOP_PASSCODE" flag:"cwop-passcode" secret:"true" help:"CWOP passcode"`
+	MQTTBroker        string `env:"MQTT_BROKER" flag:"mqtt-broker" secret:"url" help:"MQTT broker address"`
+	MQTTClientID      string `env:"MQTT_CLIENT_ID" flag:"mqtt-client-id" help:"MQTT client ID"`
+	MQTTUsername      string `env:"MQTT_USERNAME" flag:"mqtt-username" help:"MQTT username"`
+	MQTTPassword      string `env:"MQTT_PASSWORD" flag:"mqtt-password" secret:"true" help:"MQTT password"`
+	MQTTTopic         string `env:"MQTT_TOPIC" flag:"mqtt-topic" help:"MQTT topic"`
+	MQTTQoS           int    `env:"MQTT_QOS" flag:"mqtt-qos" help:"MQTT quality of service, 0 or 1"`
+	PublishCursorFile string `env:"PUBLISH_CURSOR_FILE" flag:"publish-cursor-file" help:"file keeping upload progress"`
+
+	ReportsDir string `env:"REPORTS_DIR" flag:"reports-dir" help:"directory daily reports are written to"`
+	ReportTime string `env:"REPORT_TIME" flag:"report-time" help:"time of day daily reports are made, like 07:00"`
+
+	SMTPAddr          string `env:"SMTP_ADDR" flag:"smtp-addr" help:"host:port of the SMTP server"`
+	SMTPFrom          string `env:"SMTP_FROM" flag:"smtp-from" help:"sender of emails"`
+	SMTPUsername      string `env:"SMTP_USERNAME" flag:"smtp-username" help:"SMTP username"`
+	SMTPPassword      string `env:"SMTP_PASSWORD" flag:"smtp-password" secret:"true" help:"SMTP password"`
+	SubscribersFile   string `env:"SUBSCRIBERS_FILE" flag:"subscribers-file" help:"JSON file of email subscribers"`
+	UnsubscribeSecret string `env:"UNSUBSCRIBE_SECRET" flag:"unsubscribe-secret" secret:"true" help:"unsubscribe link key"`
+
+	// sources records where each field was last set from, by field name.
+	sources map[string]string
+}
+
+// Default returns the settings used when nothing overrides them, those of the original deployment.
+func Default() *Config {
+	return &Config{
+		Port:             "8080",
+		DataURL:          "http://googledrive.com/host/0B06ZoNF0o91ncXRPdVRuZjBDaE0",
+		DataEncoding:     "UTF8",
+		CacheTTL:         Duration{20 * time.Minute},
+		RefreshInterval:  Duration{5 * time.Minute},
+		Timezone:         "-04:00",
+		StationElevation: 1700,
+		StaticDir:        "angular/app",
+		TemplatesDir:     "templates",
+		APIMaxPageSize:   10000,
+		ReadTimeout:      Duration{15 * time.Second},
+		WriteTimeout:     Duration{time.Minute},
+		IdleTimeout:      Duration{2 * time.Minute},
+		// Heroku kills processes 30 seconds after SIGTERM, which leaves time to flush once requests are drained.
+		ShutdownTimeout: Duration{20 * time.Second},
+		ReportTime:      "07:00",
+	}
+}
+
+// Load returns the settings given by the defaults, the config file, the environment and the command line args, in
+// increasing order of precedence, once they are validated.
+func Load(args []string) (*Config, error) {
+	c := Default()
+	c.sources = make(map[string]string)
+	for _, f := range c.fields() {
+		c.sources[f.name] = SourceDefault
+	}
+
+	// Flags are parsed first to find the config file, but applied last so that they override it.
+	flags := flag.NewFlagSet("chapelco-weather", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "JSON config file")
+	set := make(map[string]string)
+	for _, f := range c.fields() {
+		flags.Var(&pendingFlag{name: f.name, def: fmt.Sprint(f.value.Interface()), values: set}, f.flag, f.help)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if *path != "" {
+		if err := c.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range c.fields() {
+		// As before there was a config file, an empty variable is the same as an unset one.
+		if s := os.Getenv(f.env); s != "" {
+			if err := c.set(f, s, SourceEnv); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, f := range c.fields() {
+		if s, ok := set[f.name]; ok {
+			if err := c.set(f, s, SourceFlag); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile sets the fields named in the JSON object in the file at path.
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return errors.New("config: " + path + ": " + err.Error())
+	}
+	fields := c.fields()
+	for key, raw := range values {
+		found := false
+		for _, f := range fields {
+			if !strings.EqualFold(key, f.name) {
+				continue
+			}
+			if err := json.Unmarshal(raw, f.value.Addr().Interface()); err != nil {
+				return errors.New("config: " + path + ": " + key + ": " + err.Error())
+			}
+			c.sources[f.name] = SourceFile
+			found = true
+		}
+		if !found {
+			return errors.New("config: " + path + ": unknown setting \"" + key + "\"")
+		}
+	}
+	return nil
+}
+
+// Validate checks that the settings are usable, returning an error listing every problem found.
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "Port must be a TCP port number, not %q", c.Port)
+	check(c.DataURL != "", "DataURL must be set")
+	check(mahonia.GetCharset(c.DataEncoding) != nil, "DataEncoding %q is not a known encoding", c.DataEncoding)
+	check(c.CacheTTL.Duration > 0, "CacheTTL must be positive")
+	check(c.RefreshInterval.Duration > 0, "RefreshInterval must be positive")
+	check(c.ReadTimeout.Duration > 0, "ReadTimeout must be positive")
+	check(c.WriteTimeout.Duration > 0, "WriteTimeout must be positive")
+	check(c.IdleTimeout.Duration > 0, "IdleTimeout must be positive")
+	check(c.ShutdownTimeout.Duration > 0, "ShutdownTimeout must be positive")
+	_, err = c.Location()
+	check(err == nil, "Timezone %q is neither a known timezone nor a UTC offset like -04:00", c.Timezone)
+	check(c.StationElevation > -500 && c.StationElevation < 9000, "StationElevation must be in meters, not %v",
+		c.StationElevation)
+	check(isDir(c.StaticDir), "StaticDir %q is not a directory", c.StaticDir)
+	check(isDir(c.TemplatesDir), "TemplatesDir %q is not a directory", c.TemplatesDir)
+	check(c.APIMaxPageSize > 0, "APIMaxPageSize must be positive")
+	check(c.MQTTQoS == 0 || c.MQTTQoS == 1, "MQTTQoS must be 0 or 1")
+	_, err = time.Parse("15:04", c.ReportTime)
+	check(err == nil, "ReportTime must be a time of day like 07:30, not %q", c.ReportTime)
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"PublicURL must be an absolute http or https URL, not %q", c.PublicURL)
+	}
+	for _, origin := range c.Origins() {
+		u, err := url.Parse(origin)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && strings.Trim(u.Path, "/") == "",
+			"WebSocketOrigins must list origins like https://example.com, not %q", origin)
+	}
+	if c.SMTPAddr != "" || c.SubscribersFile != "" {
+		check(c.SMTPAddr != "" && c.SubscribersFile != "", "SMTPAddr and SubscribersFile must be set together")
+		check(c.UnsubscribeSecret != "", "UnsubscribeSecret must be set to send email")
+		check(c.PublicURL != "", "PublicURL must be set to send email")
+	}
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Location returns the timezone named by Timezone.
+func (c *Config) Location() (*time.Location, error) {
+	if t, err := time.Parse("-07:00", c.Timezone); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(c.Timezone, offset), nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// Origins returns the origins listed, comma separated, in WebSocketOrigins.
+func (c *Config) Origins() []string {
+	var origins []string
+	for _, origin := range strings.Split(c.WebSocketOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// Sources returns where each setting was taken from, by field name: one of SourceDefault, SourceFile, SourceEnv or
+// SourceFlag.
+func (c *Config) Sources() map[string]string {
+	sources := make(map[string]string, len(c.sources))
+	for name, source := range c.sources {
+		sources[name] = source
+	}
+	return sources
+}
+
+// Redacted returns a copy of c with the secret settings that are set replaced, for showing.
+func (c *Config) Redacted() *Config {
+	r := *c
+	for _, f := range r.fields() {
+		switch {
+		case f.value.String() == "":
+		case f.secret == "true":
+			f.value.SetString(redacted)
+		case f.secret == "url":
+			f.value.SetString(redactURL(f.value.String()))
+		}
+	}
+	return &r
+}
+
+// redactURL replaces the userinfo and query of the URL or host:port s, which may hold credentials.
+func redactURL(s string) string {
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		s = s[:i+1] + redacted
+	}
+	start := 0
+	if i := strings.Index(s, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	end := len(s)
+	if i := strings.IndexAny(s[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	if i := strings.LastIndex(s[start:end], "@"); i >= 0 {
+		s = s[:start] + redacted + s[start+i:]
+	}
+	return s
+}
+
+// field is a setting of a Config as described by its tags.
+type field struct {
+	name   string
+	env    string
+	flag   string
+	help   string
+	secret string
+	value  reflect.Value
+}
+
+// fields returns the settings of c, in declaration order.
+func (c *Config) fields() []field {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("env") == "" {
+			continue
+		}
+		fields = append(fields, field{
+			name:   sf.Name,
+			env:    sf.Tag.Get("env"),
+			flag:   sf.Tag.Get("flag"),
+			help:   sf.Tag.Get("help"),
+			secret: sf.Tag.Get("secret"),
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+// set parses s as the value of f, taken from source.
+func (c *Config) set(f field, s, source string) error {
+	var err error
+	switch v := f.value.Addr().Interface().(type) {
+	case *string:
+		*v = s
+	case *int:
+		*v, err = strconv.Atoi(s)
+	case *float64:
+		*v, err = strconv.ParseFloat(s, 64)
+	case *Duration:
+		err = v.Set(s)
+	}
+	if err != nil {
+		return errors.New("config: invalid " + f.name + " from " + source + ": \"" + s + "\"")
+	}
+	c.sources[f.name] = source
+	return nil
+}
+
+// pendingFlag records the value of a flag, to be applied once the config file and environment are. def is the default
+// shown in the usage message.
+type pendingFlag struct {
+	name   string
+	def    string
+	values map[string]string
+}
+
+func (p *pendingFlag) String() string { return p.def }
+
+func (p *pendingFlag) Set(s string) error {
+	p.values[p.name] = s
+	return nil
+}
+
+// isDir reports whether path names a directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
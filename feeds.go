@@ -0,0 +1,182 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/notify"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// Contents of the Atom feeds.
+const (
+	// feedDays is how many days of conditions and alerts the feeds cover, up to the latest observation.
+	feedDays = 14
+	// feedIDPrefix starts the IDs of feeds and entries. They are tag URIs so that they stay the same whatever host
+	// or language the feed is read through.
+	feedIDPrefix = "tag:chapelco.com.ar,2014:weather/"
+)
+
+// atomFeed is an Atom feed document as defined by RFC 4287.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang    string      `xml:"xml:lang,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Content atomText   `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// conditionsFeedHandler serves an Atom feed with an entry summarizing each of the last days with observations,
+// newest first. The entry of the latest day is updated with every new observation; earlier entries were last
+// updated at the end of their day.
+func conditionsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	loc := localeRequested(r)
+	base := baseURL(r)
+	feed := newFeed(r, loc, "conditions", loc.T("feed.conditions"))
+	if current := weather.ReadCurrentWeatherRecord(false); current != nil {
+		latest := weather.LocalMidnight(current.Datetime)
+		summaries := weather.ReadDailySummaries(latest.AddDate(0, 0, 1-feedDays), latest.AddDate(0, 0, 1))
+		for i := len(summaries) - 1; i >= 0; i-- {
+			s := summaries[i]
+			day, err := time.ParseInLocation("2006-01-02", s.Date, weather.StationTimezone)
+			if err != nil {
+				continue
+			}
+			updated := day.AddDate(0, 0, 1)
+			if updated.After(current.Datetime) {
+				updated = current.Datetime
+			}
+			content := []string{
+				loc.T("report.temperature", loc.Number(s.MinTemperature, 1), loc.Number(s.MaxTemperature, 1),
+					loc.Number(s.MeanTemperature, 1)),
+				loc.T("report.humidity", loc.Number(s.MinRelativeHumidity, 0), loc.Number(s.MaxRelativeHumidity, 0)),
+				loc.T("report.precipitation", loc.Number(s.Precipitation, 1)),
+				loc.T("report.sun", loc.Time(s.Sun.Sunrise.In(weather.StationTimezone)),
+					loc.Time(s.Sun.Sunset.In(weather.StationTimezone))),
+			}
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:      feedIDPrefix + "conditions/" + s.Date,
+				Title:   loc.T("feed.conditions_entry", loc.LongDate(day)),
+				Updated: atomTime(updated),
+				Links: []atomLink{{Rel: "alternate", Href: base + "/api/reports/daily/" + s.Date + "?" +
+					url.Values{"lang": {loc.Tag}}.Encode()}},
+				Content: atomText{Type: "text", Body: strings.Join(content, "\n")},
+			})
+		}
+	}
+	writeFeed(w, feed)
+}
+
+// alertsFeedHandler serves an Atom feed with an entry for each alert of the last days, the same alerts that are
+// emailed to subscribers, newest first.
+func alertsFeedHandler(w http.ResponseWriter, r *http.Request) {
+	loc := localeRequested(r)
+	base := baseURL(r)
+	feed := newFeed(r, loc, "alerts", loc.T("feed.alerts"))
+	if current := weather.ReadCurrentWeatherRecord(false); current != nil {
+		alerts := notify.Alerts(weather.LocalMidnight(current.Datetime).AddDate(0, 0, 1-feedDays))
+		for i := len(alerts) - 1; i >= 0; i-- {
+			a := alerts[i]
+			subject, text, ok := notify.DescribeAlert(a, loc)
+			if !ok {
+				continue
+			}
+			f, _ := weather.LookupField(a.Channel)
+			feed.Entries = append(feed.Entries, atomEntry{
+				ID:      feedIDPrefix + "alerts/" + a.Channel + "/" + a.Datetime.UTC().Format("20060102T150405Z"),
+				Title:   subject,
+				Updated: atomTime(a.Datetime),
+				Links: []atomLink{{Rel: "alternate", Type: "image/svg+xml", Href: base + "/api/weather/chart.svg?" +
+					url.Values{
+						"field": {f.Name},
+						"from":  {a.Datetime.Add(-24 * time.Hour).Format(time.RFC3339)},
+						"to":    {a.Datetime.Add(time.Hour).Format(time.RFC3339)},
+						"lang":  {loc.Tag},
+					}.Encode()}},
+				Content: atomText{Type: "text", Body: text},
+			})
+		}
+	}
+	writeFeed(w, feed)
+}
+
+// newFeed returns the feed named name with its title, links and author, without entries.
+func newFeed(r *http.Request, loc *i18n.Locale, name, title string) *atomFeed {
+	base := baseURL(r)
+	return &atomFeed{
+		Lang:  loc.Tag,
+		ID:    feedIDPrefix + name,
+		Title: title,
+		Author: atomAuthor{
+			Name: loc.T("page.title"),
+			URI:  base + "/",
+		},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + r.URL.RequestURI()},
+			{Rel: "alternate", Type: "text/html", Href: base + "/conditions?" + url.Values{"lang": {loc.Tag}}.Encode()},
+		},
+	}
+}
+
+// writeFeed writes feed as the response. The feed is as recent as its newest entry, or the epoch when it has none
+// so that it does not appear to change.
+func writeFeed(w http.ResponseWriter, feed *atomFeed) {
+	feed.Updated = atomTime(time.Unix(0, 0))
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+		for _, e := range feed.Entries[1:] {
+			// Entries share the format of atomTime, so the later time is the greater string.
+			if e.Updated > feed.Updated {
+				feed.Updated = e.Updated
+			}
+		}
+	}
+	response, err := xml.MarshalIndent(feed, "", "\t")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Content-Language", feed.Lang)
+	w.Write([]byte(xml.Header))
+	w.Write(response)
+}
+
+// atomTime formats t as an Atom date in UTC.
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,185 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package i18n translates the text the server writes for people, such as page labels, chart titles and error
+// messages, and formats numbers and dates the way each language expects. Messages are looked up by key in a catalog
+// per locale and are fmt formats, so translations can reorder their arguments with explicit indexes like %[2]s.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Locale is a language the server writes text in.
+type Locale struct {
+	// Tag is the BCP 47 language tag of the locale, such as "es-AR".
+	Tag       string
+	decimal   string
+	thousands string
+	// Date layouts in the format of time.Format, where {month} and {weekday} stand for the localized names.
+	date     string
+	longDate string
+	dayMonth string
+	clock    string
+	months   [12]string
+	weekdays [7]string
+	messages map[string]string
+}
+
+// Locales lists the supported locales. The first, English, is used when a client accepts none of them, and its
+// catalog supplies messages missing from the others.
+var Locales = []*Locale{English, Spanish}
+
+// Default is the locale of clients that ask for no supported language.
+var Default = English
+
+// Lookup returns the locale for tag, matching its language alone when there is no locale for its region, as "es"
+// and "es-ES" both match "es-AR". Tags are compared ignoring case.
+func Lookup(tag string) (*Locale, bool) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return nil, false
+	}
+	for _, l := range Locales {
+		if strings.EqualFold(l.Tag, tag) {
+			return l, true
+		}
+	}
+	lang := language(tag)
+	for _, l := range Locales {
+		if strings.EqualFold(language(l.Tag), lang) {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// language returns the primary language subtag of tag.
+func language(tag string) string {
+	return strings.SplitN(strings.Replace(tag, "_", "-", -1), "-", 2)[0]
+}
+
+// Match returns the supported locale preferred by an Accept-Language header, or Default if it accepts none.
+func Match(acceptLanguage string) *Locale {
+	var tags byQuality
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(part, ";")
+		w := weighted{strings.TrimSpace(params[0]), 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					w.q = q
+				}
+			}
+		}
+		if w.tag != "" && w.q > 0 {
+			tags = append(tags, w)
+		}
+	}
+	// A stable sort keeps the client's order between tags of equal weight.
+	sort.Stable(tags)
+	for _, w := range tags {
+		if l, ok := Lookup(w.tag); ok {
+			return l
+		}
+	}
+	return Default
+}
+
+// weighted is a language tag of an Accept-Language header with its quality value.
+type weighted struct {
+	tag string
+	q   float64
+}
+
+// byQuality sorts weighted tags by decreasing quality.
+type byQuality []weighted
+
+func (b byQuality) Len() int           { return len(b) }
+func (b byQuality) Less(i, j int) bool { return b[i].q > b[j].q }
+func (b byQuality) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// T returns the message key formatted with args. Messages missing from the catalog of l are taken from the English
+// one, and unknown keys are returned as they are so that they stand out.
+func (l *Locale) T(key string, args ...interface{}) string {
+	message, ok := l.messages[key]
+	if !ok {
+		if message, ok = English.messages[key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Has reports whether key is in the catalog of l or the English one.
+func (l *Locale) Has(key string) bool {
+	_, ok := l.messages[key]
+	_, english := English.messages[key]
+	return ok || english
+}
+
+// Number formats v with the given number of decimals and the locale's decimal and thousands separators.
+func (l *Locale) Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	var grouped []string
+	for len(whole) > 3 {
+		grouped = append([]string{whole[len(whole)-3:]}, grouped...)
+		whole = whole[:len(whole)-3]
+	}
+	grouped = append([]string{whole}, grouped...)
+	s = sign + strings.Join(grouped, l.thousands)
+	if fraction != "" {
+		s += l.decimal + fraction
+	}
+	return s
+}
+
+// Date formats the date of t in the short form of the locale, such as 02/07/2014 or Jul 2, 2014.
+func (l *Locale) Date(t time.Time) string {
+	return l.format(t, l.date)
+}
+
+// DayMonth formats the day and month of t without the year, such as 2/7 or 7/2.
+func (l *Locale) DayMonth(t time.Time) string {
+	return l.format(t, l.dayMonth)
+}
+
+// LongDate formats the date of t with the weekday and month spelled out.
+func (l *Locale) LongDate(t time.Time) string {
+	return l.format(t, l.longDate)
+}
+
+// Time formats the time of day of t, such as 15:04 or 3:04 PM.
+func (l *Locale) Time(t time.Time) string {
+	return l.format(t, l.clock)
+}
+
+// DateTime formats the date and time of day of t.
+func (l *Locale) DateTime(t time.Time) string {
+	return l.Date(t) + " " + l.Time(t)
+}
+
+func (l *Locale) format(t time.Time, layout string) string {
+	if t.IsZero() {
+		return "-"
+	}
+	s := t.Format(layout)
+	s = strings.Replace(s, "{month}", l.months[t.Month()-1], -1)
+	return strings.Replace(s, "{weekday}", l.weekdays[t.Weekday()], -1)
+}
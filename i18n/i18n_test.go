@@ -0,0 +1,131 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package i18n
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	for _, test := range []struct {
+		tag  string
+		want *Locale
+	}{
+		{"en", English},
+		{"es-AR", Spanish},
+		{"ES-ar", Spanish},
+		{"es", Spanish},
+		{"es-ES", Spanish},
+		{"es_MX", Spanish},
+		{"en-GB", English},
+		{" en ", English},
+		{"fr", nil},
+		{"", nil},
+		{"*", nil},
+	} {
+		l, ok := Lookup(test.tag)
+		if l != test.want || ok != (test.want != nil) {
+			t.Errorf("Lookup(%q) = %v, %v, want %v", test.tag, l, ok, test.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		want   *Locale
+	}{
+		{"", Default},
+		{"es-AR", Spanish},
+		{"es-ES,es;q=0.9,en;q=0.8", Spanish},
+		{"en;q=0.5, es;q=0.8", Spanish},
+		{"es;q=0.5, en", English},
+		{"fr-FR, fr;q=0.9, es;q=0.3", Spanish},
+		{"pt-BR, es-CL", Spanish},
+		{"es;q=0, en;q=0.1", English},
+		{"es;q=0", Default},
+		{"*", Default},
+		{"fr, *;q=0.5", Default},
+		{"es;q=0.5, en;q=0.5", Spanish},
+		{"en;q=0.5, es;q=0.5", English},
+		{"es;q=abc", Spanish},
+		{" , ;q=1", Default},
+	} {
+		if got := Match(test.header); got != test.want {
+			t.Errorf("Match(%q) = %s, want %s", test.header, got.Tag, test.want.Tag)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	for _, test := range []struct {
+		v        float64
+		decimals int
+		en, es   string
+	}{
+		{0, 1, "0.0", "0,0"},
+		{-2.5, 1, "-2.5", "-2,5"},
+		{999, 0, "999", "999"},
+		{1000, 0, "1,000", "1.000"},
+		{1013.25, 2, "1,013.25", "1.013,25"},
+		{-1234567.891, 1, "-1,234,567.9", "-1.234.567,9"},
+		{123456, 0, "123,456", "123.456"},
+		{99.96, 1, "100.0", "100,0"},
+	} {
+		if got := English.Number(test.v, test.decimals); got != test.en {
+			t.Errorf("English.Number(%v, %d) = %q, want %q", test.v, test.decimals, got, test.en)
+		}
+		if got := Spanish.Number(test.v, test.decimals); got != test.es {
+			t.Errorf("Spanish.Number(%v, %d) = %q, want %q", test.v, test.decimals, got, test.es)
+		}
+	}
+}
+
+func TestDates(t *testing.T) {
+	day := time.Date(2014, 7, 2, 15, 4, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name   string
+		format func(*Locale, time.Time) string
+		en, es string
+	}{
+		{"Date", (*Locale).Date, "Jul 2, 2014", "02/07/2014"},
+		{"LongDate", (*Locale).LongDate, "Wednesday, July 2, 2014", "miércoles 2 de julio de 2014"},
+		{"DayMonth", (*Locale).DayMonth, "7/2", "2/7"},
+		{"Time", (*Locale).Time, "3:04 PM", "15:04"},
+		{"DateTime", (*Locale).DateTime, "Jul 2, 2014 3:04 PM", "02/07/2014 15:04"},
+	} {
+		if got := test.format(English, day); got != test.en {
+			t.Errorf("English %s: %q, want %q", test.name, got, test.en)
+		}
+		if got := test.format(Spanish, day); got != test.es {
+			t.Errorf("Spanish %s: %q, want %q", test.name, got, test.es)
+		}
+		if got := test.format(Spanish, time.Time{}); got != "-" && test.name != "DateTime" {
+			t.Errorf("Spanish %s of the zero time: %q, want -", test.name, got)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	for _, test := range []struct {
+		l    *Locale
+		key  string
+		args []interface{}
+		want string
+	}{
+		{English, "page.temperature", nil, "Temperature"},
+		{Spanish, "page.temperature", nil, "Temperatura"},
+		{Spanish, "no.such.key", nil, "no.such.key"},
+	} {
+		if got := test.l.T(test.key, test.args...); got != test.want {
+			t.Errorf("%s T(%q) = %q, want %q", test.l.Tag, test.key, got, test.want)
+		}
+	}
+	for key := range English.messages {
+		if _, ok := Spanish.messages[key]; !ok {
+			t.Errorf("Spanish has no translation of %q", key)
+		}
+	}
+}
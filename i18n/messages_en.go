@@ -0,0 +1,138 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package i18n
+
+// English is the en locale, whose catalog holds every message.
+var English = &Locale{
+	Tag:       "en",
+	decimal:   ".",
+	thousands: ",",
+	date:      "Jan 2, 2006",
+	longDate:  "{weekday}, {month} 2, 2006",
+	dayMonth:  "1/2",
+	clock:     "3:04 PM",
+	months: [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September",
+		"October", "November", "December"},
+	weekdays: [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	messages: map[string]string{
+		"page.title":              "Chapelco Weather at 1700M",
+		"page.updated":            "Updated",
+		"page.temperature":        "Temperature",
+		"page.dew_point":          "Dew Point",
+		"page.humidity":           "Humidity",
+		"page.rain_today":         "Precipitation Today",
+		"page.rain_last_day":      "Last 24 Hours",
+		"page.pressure":           "Pressure",
+		"page.sea_level_pressure": "Sea Level Pressure",
+		"page.today_range":        "Today's Low / High",
+		"page.sunrise":            "Sunrise",
+		"page.sunset":             "Sunset",
+		"page.past_temperatures":  "Temperatures of the last two days",
+		"page.embed":              "Add these conditions to your site",
+		"page.embed_iframe":       "As a frame:",
+		"page.embed_snippet":      "As HTML included by your server from:",
+		"page.more_details":       "More details",
+		"page.unavailable":        "Current conditions are unavailable.",
+
+		"chart.time":           "Time",
+		"chart.past":           "Past %s",
+		"chart.hourly":         "Hourly %s",
+		"chart.daily":          "Daily %s",
+		"chart.CHN1_DEG.title": "Past Temperatures",
+		"chart.CHN1_DEG.axis":  "Temperature (°C)",
+		"chart.CHN1_DEG.noun":  "Temperatures",
+		"chart.CHN1_DEW.title": "Past Dew Points",
+		"chart.CHN1_DEW.axis":  "Temperature (°C)",
+		"chart.CHN1_DEW.noun":  "Dew Points",
+		"chart.CHN1_RF.title":  "Past Relative Humidities",
+		"chart.CHN1_RF.axis":   "Relative Humidity (%)",
+		"chart.CHN1_RF.noun":   "Relative Humidities",
+		"chart.RAIN_SUM.title": "Past Rain Sums",
+		"chart.RAIN_SUM.axis":  "MM Water",
+		"chart.RAIN_SUM.noun":  "Rain",
+		"chart.PRES_LOC.title": "Past Pressure",
+		"chart.PRES_LOC.axis":  "hPa",
+		"chart.PRES_LOC.noun":  "Pressure",
+		"chart.PRES_ABS.title": "Past Absolute Pressure",
+		"chart.PRES_ABS.axis":  "hPa",
+		"chart.PRES_ABS.noun":  "Absolute Pressure",
+		"chart.PRES_MSL.title": "Past Sea Level Pressure",
+		"chart.PRES_MSL.axis":  "hPa",
+		"chart.PRES_MSL.noun":  "Sea Level Pressure",
+		"chart.PRES_QNH.title": "Past Altimeter Setting",
+		"chart.PRES_QNH.axis":  "hPa",
+		"chart.PRES_QNH.noun":  "Altimeter Setting",
+
+		"report.title":                    "Chapelco Conditions Report for %s",
+		"report.issued":                   "Issued %s",
+		"report.day":                      "The day",
+		"report.temperature":              "Temperature: low %s °C, high %s °C, mean %s °C",
+		"report.humidity":                 "Relative humidity: %s%% to %s%%",
+		"report.precipitation":            "Precipitation: %s mm",
+		"report.sun":                      "Sunrise %s, sunset %s",
+		"report.overnight":                "Overnight, %s to %s",
+		"report.overnight_low":            "Low: %s °C",
+		"report.no_overnight":             "No observations yet.",
+		"report.new_snow":                 "New snow in the last 24 hours",
+		"report.new_snow_depth":           "About %s cm from %s mm of water.",
+		"report.no_new_snow":              "None.",
+		"report.new_snow_note":            "Estimated from precipitation and temperature; the station does not measure snow depth.",
+		"report.pressure":                 "Pressure",
+		"report.pressure_reading":         "%s hPa, %s (%s hPa in 3 hours)",
+		"report.pressure_rising_rapidly":  "rising rapidly",
+		"report.pressure_rising":          "rising",
+		"report.pressure_steady":          "steady",
+		"report.pressure_falling":         "falling",
+		"report.pressure_falling_rapidly": "falling rapidly",
+		"report.hazards":                  "Hazards",
+		"report.no_hazards":               "None reported.",
+
+		"hazard.hard_freeze":      "Hard freeze: the temperature fell to %s °C.",
+		"hazard.frost":            "Frost: the temperature fell to %s °C.",
+		"hazard.heavy_snow":       "Heavy snowfall: about %s cm of new snow.",
+		"hazard.heavy_rain":       "Heavy rain: %s mm of rain.",
+		"hazard.falling_pressure": "Pressure fell %s hPa in 3 hours; a storm may be approaching.",
+		"hazard.icing":            "Icing: near freezing temperatures with saturated air.",
+		"hazard.sensor":           "Unusual %s readings; the sensor may need checking.",
+
+		"alert.subject": "Chapelco weather alert: unusual %s reading",
+		"alert.anomaly": "The station recorded an unusual %s reading of %s %s on %s, %s standard deviations from recent readings. The sensor may need checking.",
+
+		"feed.conditions":       "Chapelco Weather at 1700M: Daily Conditions",
+		"feed.conditions_entry": "Conditions on %s",
+		"feed.alerts":           "Chapelco Weather at 1700M: Alerts",
+
+		"email.unsubscribe":         "To stop receiving these emails, visit %s",
+		"email.unsubscribe_link":    "Unsubscribe",
+		"email.confirm_unsubscribe": "Stop sending %s %s?",
+		"email.unsubscribed":        "%s will no longer receive %s.",
+		"email.scope.reports":       "daily reports",
+		"email.scope.alerts":        "alerts",
+		"email.scope.all":           "emails from the station",
+
+		"channel.CHN1_DEG": "temperature",
+		"channel.CHN1_DEW": "dew point",
+		"channel.CHN1_RF":  "humidity",
+		"channel.PRES_LOC": "pressure",
+		"channel.PRES_ABS": "absolute pressure",
+
+		"error.unavailable":            "current observation unavailable",
+		"error.no_data":                "no data in the requested range",
+		"error.unknown_aggregation":    "unknown aggregation \"%s\"",
+		"error.unknown_channel":        "unknown channel \"%s\"",
+		"error.unknown_coded_format":   "unknown coded format \"%s\"",
+		"error.unknown_export_format":  "unknown export format \"%s\"",
+		"error.delimiter":              "delimiter must be a single character other than a quote or a line break",
+		"error.limit":                  "limit must be a number from 1 to %d",
+		"error.invalid_cursor":         "invalid cursor",
+		"error.invalid_last_event_id":  "invalid Last-Event-ID: %s",
+		"error.chart_datetime":         "field must not be Datetime",
+		"error.discovered_aggregation": "discovered fields cannot be aggregated",
+		"error.unknown_report_format":  "unknown report format \"%s\"",
+		"error.no_report":              "no observations on the requested day",
+		"error.chart_size":             "%s must be a number of pixels from 100 to %d",
+		"error.invalid_unsubscribe":    "invalid unsubscribe link",
+		"error.count":                  "the number of records must be a positive whole number",
+	},
+}
@@ -0,0 +1,138 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package i18n
+
+// Spanish is the es-AR locale, the Spanish of Argentina.
+var Spanish = &Locale{
+	Tag:       "es-AR",
+	decimal:   ",",
+	thousands: ".",
+	date:      "02/01/2006",
+	longDate:  "{weekday} 2 de {month} de 2006",
+	dayMonth:  "2/1",
+	clock:     "15:04",
+	months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre",
+		"octubre", "noviembre", "diciembre"},
+	weekdays: [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+	messages: map[string]string{
+		"page.title":              "Clima en Chapelco a 1700M",
+		"page.updated":            "Actualizado",
+		"page.temperature":        "Temperatura",
+		"page.dew_point":          "Punto de rocío",
+		"page.humidity":           "Humedad",
+		"page.rain_today":         "Precipitación de hoy",
+		"page.rain_last_day":      "Últimas 24 horas",
+		"page.pressure":           "Presión",
+		"page.sea_level_pressure": "Presión a nivel del mar",
+		"page.today_range":        "Mínima / máxima de hoy",
+		"page.sunrise":            "Salida del sol",
+		"page.sunset":             "Puesta del sol",
+		"page.past_temperatures":  "Temperaturas de los últimos dos días",
+		"page.embed":              "Agregue estas condiciones a su sitio",
+		"page.embed_iframe":       "Como marco:",
+		"page.embed_snippet":      "Como HTML incluido por su servidor desde:",
+		"page.more_details":       "Más detalles",
+		"page.unavailable":        "Las condiciones actuales no están disponibles.",
+
+		"chart.time":           "Hora",
+		"chart.past":           "Historial de %s",
+		"chart.hourly":         "%s por hora",
+		"chart.daily":          "%s por día",
+		"chart.CHN1_DEG.title": "Temperaturas pasadas",
+		"chart.CHN1_DEG.axis":  "Temperatura (°C)",
+		"chart.CHN1_DEG.noun":  "Temperaturas",
+		"chart.CHN1_DEW.title": "Puntos de rocío pasados",
+		"chart.CHN1_DEW.axis":  "Temperatura (°C)",
+		"chart.CHN1_DEW.noun":  "Puntos de rocío",
+		"chart.CHN1_RF.title":  "Humedades relativas pasadas",
+		"chart.CHN1_RF.axis":   "Humedad relativa (%)",
+		"chart.CHN1_RF.noun":   "Humedades relativas",
+		"chart.RAIN_SUM.title": "Lluvia acumulada pasada",
+		"chart.RAIN_SUM.axis":  "mm de agua",
+		"chart.RAIN_SUM.noun":  "Lluvia",
+		"chart.PRES_LOC.title": "Presión pasada",
+		"chart.PRES_LOC.axis":  "hPa",
+		"chart.PRES_LOC.noun":  "Presión",
+		"chart.PRES_ABS.title": "Presión absoluta pasada",
+		"chart.PRES_ABS.axis":  "hPa",
+		"chart.PRES_ABS.noun":  "Presión absoluta",
+		"chart.PRES_MSL.title": "Presión a nivel del mar pasada",
+		"chart.PRES_MSL.axis":  "hPa",
+		"chart.PRES_MSL.noun":  "Presión a nivel del mar",
+		"chart.PRES_QNH.title": "QNH pasado",
+		"chart.PRES_QNH.axis":  "hPa",
+		"chart.PRES_QNH.noun":  "QNH",
+
+		"report.title":                    "Parte de condiciones de Chapelco del %s",
+		"report.issued":                   "Emitido el %s",
+		"report.day":                      "El día",
+		"report.temperature":              "Temperatura: mínima %s °C, máxima %s °C, media %s °C",
+		"report.humidity":                 "Humedad relativa: de %s%% a %s%%",
+		"report.precipitation":            "Precipitación: %s mm",
+		"report.sun":                      "Salida del sol %s, puesta %s",
+		"report.overnight":                "Durante la noche, de %s a %s",
+		"report.overnight_low":            "Mínima: %s °C",
+		"report.no_overnight":             "Todavía no hay observaciones.",
+		"report.new_snow":                 "Nieve nueva en las últimas 24 horas",
+		"report.new_snow_depth":           "Unos %s cm a partir de %s mm de agua.",
+		"report.no_new_snow":              "No hubo.",
+		"report.new_snow_note":            "Estimada a partir de la precipitación y la temperatura; la estación no mide el espesor de nieve.",
+		"report.pressure":                 "Presión",
+		"report.pressure_reading":         "%s hPa, %s (%s hPa en 3 horas)",
+		"report.pressure_rising_rapidly":  "en rápido ascenso",
+		"report.pressure_rising":          "en ascenso",
+		"report.pressure_steady":          "estable",
+		"report.pressure_falling":         "en descenso",
+		"report.pressure_falling_rapidly": "en rápido descenso",
+		"report.hazards":                  "Peligros",
+		"report.no_hazards":               "Ninguno informado.",
+
+		"hazard.hard_freeze":      "Helada fuerte: la temperatura bajó a %s °C.",
+		"hazard.frost":            "Helada: la temperatura bajó a %s °C.",
+		"hazard.heavy_snow":       "Nevada intensa: unos %s cm de nieve nueva.",
+		"hazard.heavy_rain":       "Lluvia intensa: %s mm de lluvia.",
+		"hazard.falling_pressure": "La presión bajó %s hPa en 3 horas; puede acercarse una tormenta.",
+		"hazard.icing":            "Engelamiento: temperaturas cercanas a cero con aire saturado.",
+		"hazard.sensor":           "Lecturas inusuales de %s; conviene revisar el sensor.",
+
+		"alert.subject": "Alerta del tiempo en Chapelco: lectura inusual de %s",
+		"alert.anomaly": "La estación registró una lectura inusual de %s de %s %s el %s, a %s desviaciones estándar de las lecturas recientes. Conviene revisar el sensor.",
+
+		"feed.conditions":       "Clima en Chapelco a 1700M: condiciones diarias",
+		"feed.conditions_entry": "Condiciones del %s",
+		"feed.alerts":           "Clima en Chapelco a 1700M: alertas",
+
+		"email.unsubscribe":         "Para dejar de recibir estos correos, visite %s",
+		"email.unsubscribe_link":    "Cancelar la suscripción",
+		"email.confirm_unsubscribe": "¿Dejar de enviar a %s %s?",
+		"email.unsubscribed":        "%s ya no recibirá %s.",
+		"email.scope.reports":       "los partes diarios",
+		"email.scope.alerts":        "las alertas",
+		"email.scope.all":           "correos de la estación",
+
+		"channel.CHN1_DEG": "temperatura",
+		"channel.CHN1_DEW": "punto de rocío",
+		"channel.CHN1_RF":  "humedad",
+		"channel.PRES_LOC": "presión",
+		"channel.PRES_ABS": "presión absoluta",
+
+		"error.unavailable":            "observación actual no disponible",
+		"error.no_data":                "no hay datos en el período pedido",
+		"error.unknown_aggregation":    "agregación desconocida \"%s\"",
+		"error.unknown_channel":        "canal desconocido \"%s\"",
+		"error.unknown_coded_format":   "formato codificado desconocido \"%s\"",
+		"error.unknown_export_format":  "formato de exportación desconocido \"%s\"",
+		"error.delimiter":              "el delimitador debe ser un carácter que no sea comilla ni salto de línea",
+		"error.limit":                  "limit debe ser un número de 1 a %d",
+		"error.invalid_cursor":         "cursor inválido",
+		"error.invalid_last_event_id":  "Last-Event-ID inválido: %s",
+		"error.chart_datetime":         "field no puede ser Datetime",
+		"error.discovered_aggregation": "los campos descubiertos no se pueden agregar",
+		"error.unknown_report_format":  "formato de parte desconocido \"%s\"",
+		"error.no_report":              "no hay observaciones en el día pedido",
+		"error.chart_size":             "%s debe ser un número de píxeles de 100 a %d",
+		"error.invalid_unsubscribe":    "enlace para cancelar la suscripción inválido",
+		"error.count":                  "la cantidad de registros debe ser un número entero positivo",
+	},
+}
@@ -1,18 +1,32 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
+	"io"
+	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
+	"github.com/EntilZha/chapelco-weather-goajs/config"
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/mqtt"
+	"github.com/EntilZha/chapelco-weather-goajs/publish"
+	"github.com/EntilZha/chapelco-weather-goajs/report"
 	"github.com/EntilZha/chapelco-weather-goajs/weather"
 
 	"github.com/gorilla/mux"
 )
 
+// cfg holds the settings of the server, loaded when it starts.
+var cfg *config.Config
+
 func currentWeatherHandler(w http.ResponseWriter, r *http.Request) {
-	response, err := json.Marshal(weather.ReadCurrentWeatherRecord())
+	response, err := json.Marshal(weather.ReadCurrentWeatherRecord(rawRequested(r)))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -21,6 +35,25 @@ func currentWeatherHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
+func currentCodedWeatherHandler(w http.ResponseWriter, r *http.Request) {
+	obs := weather.ReadCodedObservation()
+	if obs == nil {
+		http.Error(w, localeRequested(r).T("error.unavailable"), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch r.FormValue("format") {
+	case "", "synop":
+		io.WriteString(w, obs.Synop()+"\n")
+	case "metar":
+		io.WriteString(w, obs.Metar()+"\n")
+	default:
+		http.Error(w, localeRequested(r).T("error.unknown_coded_format", r.FormValue("format")), http.StatusBadRequest)
+	}
+}
+
+// pastWeatherRecordsHandler serves the last n records, at most maxLimit of them so that a single response stays
+// bounded. Clients wanting more page through /api/v1/observations, which the Link header points to.
 func pastWeatherRecordsHandler(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	n, err := strconv.Atoi(params["n"])
@@ -28,7 +61,22 @@ func pastWeatherRecordsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	response, err := json.Marshal(weather.ReadLastNWeatherRecords(n))
+	if n > maxLimit {
+		n = maxLimit
+		w.Header().Add("Link", "<"+apiPrefix+"/observations?limit="+strconv.Itoa(maxLimit)+`>; rel="alternate"`)
+	}
+	var records interface{}
+	if list := r.FormValue("fields"); list != "" {
+		fields, err := weather.ParseTableFields(list)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		records = weather.ReadLastNSparseRecords(n, fields, rawRequested(r))
+	} else {
+		records = weather.ReadLastNWeatherRecords(n, rawRequested(r))
+	}
+	response, err := json.Marshal(records)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -37,6 +85,8 @@ func pastWeatherRecordsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
+// pastWeatherListsHandler serves the last n records as a list per field, at most maxLimit of them like
+// pastWeatherRecordsHandler.
 func pastWeatherListsHandler(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	n, err := strconv.Atoi(params["n"])
@@ -44,7 +94,40 @@ func pastWeatherListsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	response, err := json.Marshal(weather.ReadLastNWeatherRecordsToMap(n))
+	if n > maxLimit {
+		n = maxLimit
+	}
+	var fields map[string]interface{}
+	if list := r.FormValue("fields"); list != "" {
+		selected, err := weather.ParseTableFields(list)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields = weather.ReadLastNFieldsToMap(n, selected, rawRequested(r))
+	} else {
+		fields = weather.ReadLastNWeatherRecordsToMap(n, rawRequested(r))
+	}
+	if sun, _ := strconv.ParseBool(r.FormValue("sun")); sun && fields != nil {
+		fields["SUN_BANDS"] = weather.ReadLastNSunBands(n)
+	}
+	response, err := json.Marshal(fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func dailySummariesHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	n, err := strconv.Atoi(params["n"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response, err := json.Marshal(weather.ReadLastNDailySummaries(n))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -53,22 +136,322 @@ func pastWeatherListsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
-func getPort() string {
-	var port = os.Getenv("PORT")
-	// Set a default port if there is nothing in the environment
-	if port == "" {
-		port = "8080"
+func sunHandler(w http.ResponseWriter, r *http.Request) {
+	day := time.Now()
+	if date := r.FormValue("date"); date != "" {
+		var err error
+		day, err = time.ParseInLocation("2006-01-02", date, weather.StationTimezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	response, err := json.Marshal(weather.SunTimesOn(day))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	return ":" + port
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func cloudEstimatesHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	n, err := strconv.Atoi(params["n"])
+	if err != nil || n < 1 {
+		http.Error(w, localeRequested(r).T("error.count"), http.StatusBadRequest)
+		return
+	}
+	response, err := json.Marshal(weather.ReadLastNCloudEstimates(n))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func lastNightSkyHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := json.Marshal(weather.ReadLastNightSky())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func anomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := parseTimeParam(r, "since", time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response, err := json.Marshal(weather.Anomalies(r.FormValue("channel"), since))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("format")
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := weather.ExportFormats[name]
+	if !ok {
+		http.Error(w, localeRequested(r).T("error.unknown_export_format", name), http.StatusBadRequest)
+		return
+	}
+	fields, err := weather.ParseFields(r.FormValue("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := parseTimeParam(r, "from", time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r, "to", time.Now().Add(24*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var delimiter rune
+	if d := []rune(r.FormValue("delimiter")); len(d) == 1 && weather.ValidDelimiter(d[0]) {
+		delimiter = d[0]
+	} else if len(d) > 0 {
+		http.Error(w, localeRequested(r).T("error.delimiter"), http.StatusBadRequest)
+		return
+	}
+	var enc weather.RecordEncoder
+	if !format.Columnar {
+		if enc, err = weather.NewRecordEncoder(name, &deadlineWriter{w, http.NewResponseController(w)},
+			delimiter); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=chapelco-weather."+format.Extension)
+	if format.Columnar {
+		err = weather.ExportColumns(name, &deadlineWriter{w, http.NewResponseController(w)}, from, to, fields,
+			rawRequested(r))
+	} else {
+		err = weather.ExportRecords(enc, from, to, fields, rawRequested(r))
+	}
+	if err != nil {
+		// Rows may already have been sent, so the error can only be logged.
+		log.Println("export:", err)
+	}
+}
+
+// deadlineWriter gives each write to a response WriteTimeout of its own, so that exports taking longer than
+// WriteTimeout as a whole are not cut off while they keep making progress.
+type deadlineWriter struct {
+	w          io.Writer
+	controller *http.ResponseController
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.controller.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout.Duration))
+	return d.w.Write(p)
+}
+
+// parseTimeParam parses the form value name as an RFC 3339 time or a date in the station's timezone, returning def
+// if it is empty.
+func parseTimeParam(r *http.Request, name string, def time.Time) (time.Time, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return def, nil
+	}
+	return weather.ParseTime(value)
+}
+
+func prometheusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := weather.WritePrometheus(w); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+}
+
+func calibrationsHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := json.Marshal(weather.Calibrations())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// rawRequested reports whether the request asked for values without calibration corrections with ?raw=true.
+func rawRequested(r *http.Request) bool {
+	raw, _ := strconv.ParseBool(r.FormValue("raw"))
+	return raw
+}
+
+// localeRequested returns the locale to write text for r in: the lang parameter, else the preferred supported language
+// of the Accept-Language header, else the default.
+func localeRequested(r *http.Request) *i18n.Locale {
+	if l, ok := i18n.Lookup(r.FormValue("lang")); ok {
+		return l
+	}
+	return i18n.Match(r.Header.Get("Accept-Language"))
+}
+
+// configure applies the settings in cfg to the packages that read the station's data and render pages and reports.
+func configure() {
+	location, err := cfg.Location()
+	if err != nil {
+		log.Fatal(err)
+	}
+	weather.DataURL = cfg.DataURL
+	weather.DataEncoding = cfg.DataEncoding
+	weather.CacheTTL = cfg.CacheTTL.Duration
+	weather.StationTimezone = location
+	weather.StationElevation = cfg.StationElevation
+	templatesDir = cfg.TemplatesDir
+	report.TemplatesDir = filepath.Join(cfg.TemplatesDir, "reports")
+	maxLimit = cfg.APIMaxPageSize
+}
+
+// loadCalibrations registers the calibrations in CalibrationsFile, if it is set.
+func loadCalibrations() {
+	if cfg.CalibrationsFile != "" {
+		if err := weather.LoadCalibrations(cfg.CalibrationsFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// startPublishers uploads new observations to the networks configured: Weather Underground when WUStationID is set,
+// CWOP when CWOPCallsign is set and an MQTT broker when MQTTBroker is set. WUURL and CWOPServer override their
+// endpoints and PublishCursorFile is where upload progress is kept between restarts. It returns the Dispatcher
+// uploading, or nil if no network is configured.
+func startPublishers() *publish.Dispatcher {
+	var publishers []publish.Publisher
+	if cfg.WUStationID != "" {
+		publishers = append(publishers, &publish.Wunderground{
+			URL:       cfg.WUURL,
+			StationID: cfg.WUStationID,
+			Password:  cfg.WUPassword,
+		})
+	}
+	if cfg.CWOPCallsign != "" {
+		publishers = append(publishers, &publish.CWOP{
+			Server:   cfg.CWOPServer,
+			Callsign: cfg.CWOPCallsign,
+			Passcode: cfg.CWOPPasscode,
+		})
+	}
+	if cfg.MQTTBroker != "" {
+		publishers = append(publishers, &publish.MQTT{
+			Options: mqtt.Options{
+				Broker:   cfg.MQTTBroker,
+				ClientID: cfg.MQTTClientID,
+				Username: cfg.MQTTUsername,
+				Password: cfg.MQTTPassword,
+			},
+			Topic: cfg.MQTTTopic,
+			QoS:   byte(cfg.MQTTQoS),
+		})
+	}
+	if len(publishers) == 0 {
+		return nil
+	}
+	dispatcher, err := publish.NewDispatcher(cfg.PublishCursorFile, publishers...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dispatcher.Start()
+	return dispatcher
 }
 
 func main() {
+	var err error
+	if cfg, err = config.Load(os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	configure()
+	loadCalibrations()
+	loadPageTemplates()
+	dispatcher := startPublishers()
+	startNotifier()
+	stopReports := startReports()
+	// The table is only refreshed when read, so keep reading it for publishers and streams even when nobody visits.
+	stopRefresh := weather.KeepRefreshed(cfg.RefreshInterval.Duration)
 	router := mux.NewRouter()
-	router.HandleFunc("/api/weather/current", currentWeatherHandler)
-	router.HandleFunc("/api/weather/past-record-list/{n}", pastWeatherRecordsHandler)
-	router.HandleFunc("/api/weather/past-field-lists/{n}", pastWeatherListsHandler)
-	router.PathPrefix("/").Handler(http.FileServer(http.Dir("angular/app")))
-	router.PathPrefix("/bower_components").Handler(http.FileServer(http.Dir("angular/app/bower_components")))
-	http.Handle("/", router)
-	http.ListenAndServe(getPort(), nil)
+	router.HandleFunc("/api/weather/current", cacheable(currentWeatherHandler))
+	router.HandleFunc("/api/weather/current.txt", cacheable(currentCodedWeatherHandler))
+	router.HandleFunc("/api/weather/stream", streamHandler)
+	router.HandleFunc("/api/weather/subscribe", subscriptionsHandler)
+	router.HandleFunc("/api/weather/past-record-list/{n}", cacheable(pastWeatherRecordsHandler))
+	router.HandleFunc("/api/weather/past-field-lists/{n}", cacheable(pastWeatherListsHandler))
+	router.HandleFunc("/api/weather/daily/{n}", cacheable(dailySummariesHandler))
+	router.HandleFunc("/api/weather/sun", cacheableFor(sunHandler, stationDay))
+	router.HandleFunc("/api/weather/clouds/last-night", cacheableFor(lastNightSkyHandler, weather.LastNightPeriod))
+	router.HandleFunc("/api/weather/clouds/{n}", cacheable(cloudEstimatesHandler))
+	router.HandleFunc("/api/weather/anomalies", cacheable(anomaliesHandler))
+	router.HandleFunc("/api/weather/calibrations", cacheable(calibrationsHandler))
+	router.HandleFunc("/api/weather/export", cacheable(exportHandler))
+	router.HandleFunc("/api/weather/chart.svg", cacheable(chartHandler))
+	router.HandleFunc("/api/weather/chart.png", cacheable(chartHandler))
+	router.HandleFunc("/api/reports/daily/{date}", cacheable(reportHandler))
+	router.HandleFunc("/metrics/weather", prometheusHandler)
+	router.HandleFunc("/conditions", cacheable(conditionsPageHandler))
+	router.HandleFunc("/widget", cacheable(widgetHandler))
+	router.HandleFunc("/widget/snippet", cacheable(widgetSnippetHandler))
+	router.HandleFunc("/unsubscribe", unsubscribeHandler)
+	router.HandleFunc("/feeds/conditions.atom", cacheable(conditionsFeedHandler))
+	router.HandleFunc("/feeds/alerts.atom", cacheable(alertsFeedHandler))
+	router.HandleFunc("/api/admin/config", adminOnly(adminConfigHandler))
+	router.HandleFunc("/api/admin/calibrations", adminOnly(adminCalibrationsHandler)).Methods("POST")
+	router.HandleFunc("/healthz", healthHandler)
+	router.HandleFunc("/readyz", readyHandler)
+	registerAPIRoutes(router)
+	router.PathPrefix("/").Handler(http.FileServer(http.Dir(cfg.StaticDir)))
+	bower := filepath.Join(cfg.StaticDir, "bower_components")
+	router.PathPrefix("/bower_components").Handler(http.FileServer(http.Dir(bower)))
+	if err := serve(router); err != nil {
+		log.Fatal(err)
+	}
+
+	// Requests are drained, so stop the work done in the background and save what it keeps, giving up after
+	// flushTimeout. The publishers save their cursors first, as that is quick and whatever they miss is sent from the
+	// cursors on the next start; then refreshes and reports stop, and the reports and alerts they queued are sent in
+	// the time left.
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		if dispatcher != nil {
+			if err := dispatcher.Close(); err != nil {
+				log.Println("publish:", err)
+			}
+		}
+		stopRefresh()
+		if stopReports != nil {
+			stopReports()
+		}
+		if notifier != nil {
+			if err := notifier.Close(ctx); err != nil {
+				log.Println("notify: dropping unsent notifications:", err)
+			}
+		}
+	}()
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		log.Println("shutdown: gave up flushing:", ctx.Err())
+		return
+	}
+	log.Println("shutdown: done")
 }
@@ -0,0 +1,246 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package mqtt is a minimal MQTT 3.1.1 client that publishes messages at QoS 0 or 1. It does not subscribe.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// timeout bounds each exchange with the broker. It is a variable so that tests can shorten it.
+var timeout = 30 * time.Second
+
+// DefaultKeepAlive is the keep alive of connections whose Options do not set one.
+const DefaultKeepAlive = 60 * time.Second
+
+// Options configure a connection. Broker is the host:port of the broker; Username and Password are sent when
+// Username is set. KeepAlive is the longest the client stays silent, pinging the broker when it has nothing to
+// publish; 0 means DefaultKeepAlive.
+type Options struct {
+	Broker    string
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+// Client is a connection to an MQTT broker. It is not safe for concurrent use.
+type Client struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	packetID  uint16
+	keepAlive time.Duration
+	done      chan struct{}
+	// mu serializes exchanges with the broker between the caller and the goroutine sending pings. lastSent is when a
+	// packet was last sent and err the error that broke the connection, if any.
+	mu       sync.Mutex
+	lastSent time.Time
+	err      error
+}
+
+// Dial connects to the broker in opts with a clean session. Once nothing has been sent for half the KeepAlive, checked
+// every quarter of it, the client pings the broker, so that a connection the broker no longer answers on is found
+// before messages are published to it: Publish then returns the error that broke the connection.
+func Dial(opts Options) (*Client, error) {
+	keepAlive := opts.KeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	seconds := int(keepAlive / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	} else if seconds > 65535 {
+		seconds = 65535
+	}
+	conn, err := net.DialTimeout("tcp", opts.Broker, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn), keepAlive: keepAlive, done: make(chan struct{})}
+	flags := byte(0x02)
+	var payload []byte
+	payload = appendString(payload, opts.ClientID)
+	if opts.Username != "" {
+		flags |= 0x80 | 0x40
+		payload = appendString(payload, opts.Username)
+		payload = appendString(payload, opts.Password)
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags, byte(seconds>>8), byte(seconds))
+	if err := c.write(packetConnect<<4, append(body, payload...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	typ, ack, err := c.read(timeout)
+	if err == nil && (typ != packetConnack || len(ack) != 2) {
+		err = errors.New("mqtt: expected CONNACK")
+	}
+	if err == nil && ack[1] != 0 {
+		err = errors.New("mqtt: connection refused with code " + strconv.Itoa(int(ack[1])))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.ping()
+	return c, nil
+}
+
+// ping sends PINGREQ whenever nothing has been sent for half the keep alive, leaving the broker time to answer before
+// it gives up on the client, and closes the connection if the broker does not answer.
+func (c *Client) ping() {
+	ticker := time.NewTicker(c.keepAlive / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			return
+		}
+		c.mu.Lock()
+		if c.err == nil && time.Since(c.lastSent) >= c.keepAlive/2 {
+			err := c.write(packetPingreq<<4, nil)
+			if err == nil {
+				// Publish is held up until the broker answers, so the wait is bounded by timeout as well as by when
+				// the broker expects the next packet.
+				wait := timeout
+				if c.keepAlive/2 < wait {
+					wait = c.keepAlive / 2
+				}
+				var typ byte
+				if typ, _, err = c.read(wait); err == nil && typ != packetPingresp {
+					err = errors.New("mqtt: expected PINGRESP")
+				}
+			}
+			if err != nil {
+				c.err = err
+				c.conn.Close()
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Publish sends payload to topic at qos 0 or 1, asking the broker to keep it for new subscribers when retain is set.
+// At QoS 1 Publish waits for the broker to acknowledge the message.
+func (c *Client) Publish(topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 1 {
+		return errors.New("mqtt: unsupported QoS " + strconv.Itoa(int(qos)))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	header := byte(packetPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	if qos > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		body = append(body, byte(c.packetID>>8), byte(c.packetID))
+	}
+	if err := c.write(header, append(body, payload...)); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	typ, ack, err := c.read(timeout)
+	if err != nil {
+		return err
+	}
+	if typ != packetPuback || len(ack) != 2 || binary.BigEndian.Uint16(ack) != c.packetID {
+		return errors.New("mqtt: expected PUBACK for packet " + strconv.Itoa(int(c.packetID)))
+	}
+	return nil
+}
+
+// Close disconnects from the broker.
+func (c *Client) Close() error {
+	close(c.done)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil
+	}
+	c.write(packetDisconnect<<4, nil)
+	return c.conn.Close()
+}
+
+// write sends a packet with the fixed header byte header and body. c.mu must be held once Dial has returned.
+func (c *Client) write(header byte, body []byte) error {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	c.lastSent = time.Now()
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// read reads a packet within wait and returns its type and body. c.mu must be held once Dial has returned.
+func (c *Client) read(wait time.Duration) (byte, []byte, error) {
+	c.conn.SetDeadline(time.Now().Add(wait))
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		if i == 4 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		n += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+// appendString appends s to b as a length prefixed UTF-8 string.
+func appendString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
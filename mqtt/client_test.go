@@ -0,0 +1,249 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// packet is a control packet read by a fake broker: its fixed header byte and its body.
+type packet struct {
+	header byte
+	body   []byte
+}
+
+// readPacket reads a control packet from r, decoding the remaining length as the MQTT 3.1.1 specification describes.
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	n, multiplier := 0, 1
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		n += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return packet{header, body}, err
+}
+
+// fakeBroker accepts one connection on a local port and passes it to serve, returning the address it listens on and a
+// channel that receives the packets serve reads with its read func.
+func fakeBroker(t *testing.T, serve func(read func() (packet, error), conn net.Conn)) (string, <-chan packet) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := make(chan packet, 100)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		serve(func() (packet, error) {
+			p, err := readPacket(r)
+			if err == nil {
+				packets <- p
+			}
+			return p, err
+		}, conn)
+	}()
+	return l.Addr().String(), packets
+}
+
+// accept answers CONNECT with a CONNACK with code.
+func accept(read func() (packet, error), conn net.Conn, code byte) error {
+	if _, err := read(); err != nil {
+		return err
+	}
+	_, err := conn.Write([]byte{packetConnack << 4, 2, 0, code})
+	return err
+}
+
+func TestDial(t *testing.T) {
+	addr, packets := fakeBroker(t, func(read func() (packet, error), conn net.Conn) {
+		if accept(read, conn, 0) == nil {
+			read()
+		}
+	})
+	c, err := Dial(Options{Broker: addr, ClientID: "chapelco", Username: "station", Password: "secret",
+		KeepAlive: 90 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connect := <-packets
+	want := []byte{0, 4, 'M', 'Q', 'T', 'T', 4, 0xc2, 0, 90, 0, 8, 'c', 'h', 'a', 'p', 'e', 'l', 'c', 'o',
+		0, 7, 's', 't', 'a', 't', 'i', 'o', 'n', 0, 6, 's', 'e', 'c', 'r', 'e', 't'}
+	if connect.header != packetConnect<<4 || !bytes.Equal(connect.body, want) {
+		t.Errorf("CONNECT %#x % x, want %#x % x", connect.header, connect.body, packetConnect<<4, want)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if disconnect := <-packets; disconnect.header != packetDisconnect<<4 || len(disconnect.body) != 0 {
+		t.Errorf("closed with %#x % x, want DISCONNECT", disconnect.header, disconnect.body)
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	addr, _ := fakeBroker(t, func(read func() (packet, error), conn net.Conn) {
+		accept(read, conn, 5)
+	})
+	_, err := Dial(Options{Broker: addr, ClientID: "chapelco"})
+	if err == nil || !strings.Contains(err.Error(), "code 5") {
+		t.Errorf("Dial returned %v, want the refusal code", err)
+	}
+}
+
+func TestPublishQoS1(t *testing.T) {
+	addr, packets := fakeBroker(t, func(read func() (packet, error), conn net.Conn) {
+		if accept(read, conn, 0) != nil {
+			return
+		}
+		for i := 0; ; i++ {
+			p, err := read()
+			if err != nil || p.header>>4 != packetPublish {
+				return
+			}
+			// The second message is acknowledged with the wrong packet identifier.
+			id := p.body[len(p.body)-2-len("payload") : len(p.body)-len("payload")]
+			if i == 1 {
+				id = []byte{0xff, 0xff}
+			}
+			conn.Write(append([]byte{packetPuback << 4, 2}, id...))
+		}
+	})
+	c, err := Dial(Options{Broker: addr, ClientID: "chapelco"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-packets
+	if err := c.Publish("weather/chapelco", []byte("payload"), 1, true); err != nil {
+		t.Fatal(err)
+	}
+	publish := <-packets
+	want := append([]byte{0, 16}, "weather/chapelco"...)
+	want = append(append(want, 0, 1), "payload"...)
+	if publish.header != packetPublish<<4|0x02|0x01 || !bytes.Equal(publish.body, want) {
+		t.Errorf("PUBLISH %#x % x, want %#x % x", publish.header, publish.body, packetPublish<<4|0x03, want)
+	}
+	err = c.Publish("weather/chapelco", []byte("payload"), 1, false)
+	if err == nil || !strings.Contains(err.Error(), "PUBACK for packet 2") {
+		t.Errorf("Publish acknowledged for another packet returned %v", err)
+	}
+	if err := c.Publish("weather/chapelco", nil, 2, false); err == nil {
+		t.Error("Publish at QoS 2 succeeded")
+	}
+}
+
+func TestRemainingLength(t *testing.T) {
+	for _, test := range []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	} {
+		client, broker := net.Pipe()
+		c := &Client{conn: client, r: bufio.NewReader(client)}
+		body := bytes.Repeat([]byte{'x'}, test.n)
+		go func() {
+			c.write(packetPublish<<4, body)
+		}()
+		r := bufio.NewReader(broker)
+		got := make([]byte, 1+len(test.want))
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got[1:], test.want) {
+			t.Errorf("remaining length %d encoded as % x, want % x", test.n, got[1:], test.want)
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(test.n)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The client decodes what it encodes.
+		go func() {
+			broker.Write(append(append([]byte{packetPuback << 4}, test.want...), body...))
+		}()
+		typ, read, err := c.read(time.Second)
+		if err != nil || typ != packetPuback || len(read) != test.n {
+			t.Errorf("remaining length %d read as %d bytes of type %d: %v", test.n, len(read), typ, err)
+		}
+		client.Close()
+		broker.Close()
+	}
+}
+
+func TestMalformedRemainingLength(t *testing.T) {
+	client, broker := net.Pipe()
+	defer client.Close()
+	defer broker.Close()
+	c := &Client{conn: client, r: bufio.NewReader(client)}
+	go broker.Write([]byte{packetPuback << 4, 0x80, 0x80, 0x80, 0x80, 0x01})
+	if _, _, err := c.read(time.Second); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("read returned %v, want a malformed remaining length", err)
+	}
+}
+
+func TestPingFailure(t *testing.T) {
+	defer func(wait time.Duration) { timeout = wait }(timeout)
+	timeout = time.Second
+	addr, packets := fakeBroker(t, func(read func() (packet, error), conn net.Conn) {
+		if accept(read, conn, 0) != nil {
+			return
+		}
+		// The first ping is answered and the second is not.
+		if p, err := read(); err != nil || p.header != packetPingreq<<4 {
+			return
+		}
+		conn.Write([]byte{packetPingresp << 4, 0})
+		read()
+		time.Sleep(time.Second)
+	})
+	c, err := Dial(Options{Broker: addr, ClientID: "chapelco", KeepAlive: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-packets
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-packets:
+			if p.header != packetPingreq<<4 || len(p.body) != 0 {
+				t.Errorf("sent %#x % x while idle, want PINGREQ", p.header, p.body)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no ping while idle")
+		}
+	}
+	// The unanswered ping is given the shorter of timeout and half the keep alive, then breaks the connection.
+	time.Sleep(200 * time.Millisecond)
+	if err := c.Publish("weather/chapelco", []byte("payload"), 0, false); err == nil {
+		t.Error("Publish succeeded after a ping went unanswered")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/notify"
+)
+
+// notifier emails reports and alerts to subscribers, nil unless configured by startNotifier.
+var notifier *notify.Notifier
+
+// subscribers and unsubscribeSecret are what unsubscribe links are checked against when notifier is set.
+var (
+	subscribers       *notify.Subscribers
+	unsubscribeSecret []byte
+)
+
+// unsubscribePage is the data the unsubscribe template is executed with.
+type unsubscribePage struct {
+	Locale *i18n.Locale
+	Email  string
+	Scope  string
+	Token  string
+	Done   bool
+}
+
+// ScopeKey is the message key naming the scope of the page.
+func (p *unsubscribePage) ScopeKey() string {
+	return "email.scope." + p.Scope
+}
+
+// startNotifier emails the daily report and alerts to the subscribers listed in SubscribersFile through the SMTP
+// server at SMTPAddr, if both are set. SMTPFrom is the sender, SMTPUsername and SMTPPassword the credentials if the
+// server needs them. Unsubscribe links point to PublicURL, the address the server is reached at, and are signed with
+// UnsubscribeSecret; config.Load makes sure both are set.
+func startNotifier() {
+	if cfg.SMTPAddr == "" || cfg.SubscribersFile == "" {
+		return
+	}
+	list, err := notify.LoadSubscribers(cfg.SubscribersFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailer := &notify.Mailer{
+		Addr:     cfg.SMTPAddr,
+		From:     cfg.SMTPFrom,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+	}
+	subscribers, unsubscribeSecret = list, []byte(cfg.UnsubscribeSecret)
+	notifier = notify.NewNotifier(mailer, subscribers, unsubscribeSecret, cfg.PublicURL)
+	notifier.Start()
+}
+
+// unsubscribeHandler serves the links in emails. GET asks to confirm, so that mail scanners following links do not
+// unsubscribe anyone, and POST unsubscribes, which is also what mail clients offering one click unsubscribe send.
+func unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	loc := localeRequested(r)
+	page := &unsubscribePage{
+		Locale: loc,
+		Email:  r.FormValue("email"),
+		Scope:  r.FormValue("scope"),
+		Token:  r.FormValue("token"),
+	}
+	if subscribers == nil || !notify.ValidScope(page.Scope) ||
+		!notify.ValidUnsubscribeToken(unsubscribeSecret, page.Email, page.Scope, page.Token) {
+		http.Error(w, loc.T("error.invalid_unsubscribe"), http.StatusForbidden)
+		return
+	}
+	if r.Method == "POST" {
+		// Unsubscribing twice is not an error, as the link stays in the email after it is used.
+		if _, err := subscribers.Unsubscribe(page.Email, page.Scope); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.Done = true
+	}
+	renderPage(w, "unsubscribe", loc, page)
+}
@@ -0,0 +1,187 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package notify emails the daily reports and the alerts of the service to a list of subscribers over SMTP. Each
+// subscriber chooses what to receive and in which language, and every message carries a signed link that
+// unsubscribes its recipient without logging in.
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Message is an email with a plain text body and, optionally, an HTML alternative showing Inline images.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	// Headers are added to the message as they are, such as List-Unsubscribe.
+	Headers map[string]string
+	Text    string
+	HTML    string
+	Inline  []Inline
+}
+
+// Inline is an image shown in the HTML body of a message, which refers to it as cid:ContentID.
+type Inline struct {
+	ContentID   string
+	ContentType string
+	Data        []byte
+}
+
+// Bytes encodes m as a MIME message. With an HTML body the message is multipart/alternative, wrapped in
+// multipart/related when there are inline images.
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	header := map[string]string{
+		"From":         m.From,
+		"To":           m.To,
+		"Subject":      encodeHeader(m.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   messageID(m.From),
+		"MIME-Version": "1.0",
+	}
+	for k, v := range m.Headers {
+		header[k] = v
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, header[k])
+	}
+	if m.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n")
+		writeBase64(&buf, []byte(m.Text))
+		return buf.Bytes(), nil
+	}
+	if len(m.Inline) == 0 {
+		if err := writeAlternative(&buf, m, nil); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	related := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/related; boundary=%s\r\n\r\n", related.Boundary())
+	if err := writeAlternative(&buf, m, related); err != nil {
+		return nil, err
+	}
+	for _, inline := range m.Inline {
+		part, err := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {inline.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + inline.ContentID + ">"},
+			"Content-Disposition":       {"inline"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		var data bytes.Buffer
+		writeBase64(&data, inline.Data)
+		part.Write(data.Bytes())
+	}
+	if err := related.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeAlternative writes the text and HTML bodies of m as a multipart/alternative entity, as a part of parent when
+// it is set and as the rest of the message in buf otherwise.
+func writeAlternative(buf *bytes.Buffer, m *Message, parent *multipart.Writer) error {
+	var body bytes.Buffer
+	alternative := multipart.NewWriter(&body)
+	contentType := "multipart/alternative; boundary=" + alternative.Boundary()
+	for _, p := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return err
+		}
+		var data bytes.Buffer
+		writeBase64(&data, []byte(p.content))
+		part.Write(data.Bytes())
+	}
+	if err := alternative.Close(); err != nil {
+		return err
+	}
+	if parent == nil {
+		fmt.Fprintf(buf, "Content-Type: %s\r\n\r\n", contentType)
+		_, err := body.WriteTo(buf)
+		return err
+	}
+	part, err := parent.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	_, err = body.WriteTo(part)
+	return err
+}
+
+// writeBase64 writes data in base64 broken into lines of 76 characters, as MIME requires.
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+}
+
+// encodeHeader encodes a header value with RFC 2047 encoded words when it is not plain ASCII, splitting it between
+// characters so that no encoded word is longer than 75 characters.
+func encodeHeader(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r >= utf8.RuneSelf || r < ' ' {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+	var words []string
+	for len(s) > 0 {
+		// 45 bytes of UTF-8 encode to 60 characters of base64, which with the 12 of the markers stays under 75.
+		n := 0
+		for n < len(s) {
+			_, size := utf8.DecodeRuneInString(s[n:])
+			if n+size > 45 {
+				break
+			}
+			n += size
+		}
+		words = append(words, "=?UTF-8?B?"+base64.StdEncoding.EncodeToString([]byte(s[:n]))+"?=")
+		s = s[n:]
+	}
+	return strings.Join(words, "\r\n ")
+}
+
+// messageID returns a unique Message-ID in the domain of the address from.
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.TrimRight(from[i+1:], ">")
+	}
+	random := make([]byte, 12)
+	rand.Read(random)
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
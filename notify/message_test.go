@@ -0,0 +1,208 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// readMessage parses data as a mail message, failing t if it is not one.
+func readMessage(t *testing.T, data []byte) *mail.Message {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid message: %v\n%s", err, data)
+	}
+	return msg
+}
+
+// decodeBody returns the content of a part, decoding it from base64 after checking its lines are no longer than 76
+// characters.
+func decodeBody(t *testing.T, r io.Reader) string {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("base64 line of %d characters", len(line))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.Replace(string(data), "\r\n", "", -1))
+	if err != nil {
+		t.Fatalf("invalid base64 %q: %v", data, err)
+	}
+	return string(decoded)
+}
+
+// part is a part of a multipart entity read by parts.
+type part struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// parts returns the parts of a multipart entity with the given Content-Type, which must be of mediaType.
+func parts(t *testing.T, contentType, mediaType string, body io.Reader) []part {
+	typ, params, err := mime.ParseMediaType(contentType)
+	if err != nil || typ != mediaType {
+		t.Fatalf("Content-Type %q, want %s", contentType, mediaType)
+	}
+	r := multipart.NewReader(body, params["boundary"])
+	var list []part
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return list
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, part{p.Header, data})
+	}
+}
+
+func TestTextMessage(t *testing.T) {
+	text := strings.Repeat("Temperatura mínima: -2,5 °C. ", 10)
+	data, err := (&Message{
+		From:    "Chapelco <weather@example.com>",
+		To:      "someone@example.org",
+		Subject: "Daily report",
+		Headers: map[string]string{"List-Unsubscribe": "<https://example.com/unsubscribe>"},
+		Text:    text,
+	}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := readMessage(t, data)
+	for key, want := range map[string]string{
+		"From":                      "Chapelco <weather@example.com>",
+		"To":                        "someone@example.org",
+		"Subject":                   "Daily report",
+		"List-Unsubscribe":          "<https://example.com/unsubscribe>",
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "base64",
+	} {
+		if got := msg.Header.Get(key); got != want {
+			t.Errorf("%s: %q, want %q", key, got, want)
+		}
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID %q is not in the domain of the sender", id)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if body := decodeBody(t, msg.Body); body != text {
+		t.Errorf("body %q, want %q", body, text)
+	}
+}
+
+func TestAlternativeMessage(t *testing.T) {
+	data, err := (&Message{To: "someone@example.org", Text: "plain", HTML: "<p>rich</p>"}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := readMessage(t, data)
+	alternatives := parts(t, msg.Header.Get("Content-Type"), "multipart/alternative", msg.Body)
+	checkAlternatives(t, alternatives, "plain", "<p>rich</p>")
+}
+
+// checkAlternatives checks the parts of a multipart/alternative entity are text and html, in that order.
+func checkAlternatives(t *testing.T, alternatives []part, text, html string) {
+	if len(alternatives) != 2 {
+		t.Fatalf("%d alternatives, want text and HTML", len(alternatives))
+	}
+	for i, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		part := alternatives[i]
+		if got := part.header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("alternative %d is %q, want %q", i, got, want.contentType)
+		}
+		if got := part.header.Get("Content-Transfer-Encoding"); got != "base64" {
+			t.Errorf("alternative %d is encoded as %q", i, got)
+		}
+		if body := decodeBody(t, bytes.NewReader(part.body)); body != want.body {
+			t.Errorf("alternative %d is %q, want %q", i, body, want.body)
+		}
+	}
+}
+
+func TestRelatedMessage(t *testing.T) {
+	chart := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 100)
+	data, err := (&Message{
+		To:     "someone@example.org",
+		Text:   "plain",
+		HTML:   `<img src="cid:chart@chapelco">`,
+		Inline: []Inline{{ContentID: "chart@chapelco", ContentType: "image/png", Data: chart}},
+	}).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := readMessage(t, data)
+	related := parts(t, msg.Header.Get("Content-Type"), "multipart/related", msg.Body)
+	if len(related) != 2 {
+		t.Fatalf("%d related parts, want the alternatives and the image", len(related))
+	}
+	alternatives := parts(t, related[0].header.Get("Content-Type"), "multipart/alternative",
+		bytes.NewReader(related[0].body))
+	checkAlternatives(t, alternatives, "plain", `<img src="cid:chart@chapelco">`)
+	image := related[1]
+	for key, want := range map[string]string{
+		"Content-Type":        "image/png",
+		"Content-ID":          "<chart@chapelco>",
+		"Content-Disposition": "inline",
+	} {
+		if got := image.header.Get(key); got != want {
+			t.Errorf("image %s: %q, want %q", key, got, want)
+		}
+	}
+	if body := decodeBody(t, bytes.NewReader(image.body)); body != string(chart) {
+		t.Errorf("image of %d bytes, want %d", len(body), len(chart))
+	}
+}
+
+func TestEncodeHeader(t *testing.T) {
+	decoder := new(mime.WordDecoder)
+	for _, subject := range []string{
+		"Daily report",
+		"Informe diario: mínima de -2,5 °C",
+		strings.Repeat("ñ", 100),
+		"Alerta ⚠ " + strings.Repeat("viento ", 20),
+		"tab\tseparated",
+	} {
+		encoded := encodeHeader(subject)
+		for _, line := range strings.Split(encoded, "\r\n ") {
+			if len(line) > 75 {
+				t.Errorf("%q: encoded word of %d characters", subject, len(line))
+			}
+		}
+		plain := encoded == subject
+		if ascii := strings.IndexFunc(subject, func(r rune) bool { return r < ' ' || r >= 0x80 }) < 0; plain != ascii {
+			t.Errorf("%q encoded as %q", subject, encoded)
+		}
+		decoded, err := decoder.DecodeHeader(strings.Replace(encoded, "\r\n ", " ", -1))
+		if err != nil {
+			t.Errorf("%q: %v", subject, err)
+			continue
+		}
+		if decoded != subject {
+			t.Errorf("%q decoded as %q", subject, decoded)
+		}
+	}
+}
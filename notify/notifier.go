@@ -0,0 +1,328 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/chart"
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/report"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// Tuning of notification delivery.
+const (
+	// alertInterval is the least time between alerts about the same channel, so that a failing sensor does not flood
+	// inboxes.
+	alertInterval = time.Hour
+	// maxJobs is how many reports and alerts can wait to be sent before new ones are dropped.
+	maxJobs = 100
+	// chartID is the Content-ID of the chart shown in messages.
+	chartID = "chart@chapelco-weather"
+)
+
+// Notifier emails reports and alerts to subscribers from a goroutine of its own, so that slow SMTP servers hold up
+// neither the refresh of the weather table nor the report schedule.
+type Notifier struct {
+	mailer      *Mailer
+	subscribers *Subscribers
+	secret      []byte
+	baseURL     string
+	mu          sync.Mutex
+	jobs        chan func()
+	closed      bool
+	dropping    bool
+	lastAlert   map[string]time.Time
+	wg          sync.WaitGroup
+}
+
+// NewNotifier returns a Notifier sending to subscribers through mailer. Unsubscribe links point to baseURL/unsubscribe
+// and are signed with secret.
+func NewNotifier(mailer *Mailer, subscribers *Subscribers, secret []byte, baseURL string) *Notifier {
+	n := &Notifier{
+		mailer:      mailer,
+		subscribers: subscribers,
+		secret:      secret,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		jobs:        make(chan func(), maxJobs),
+		lastAlert:   make(map[string]time.Time),
+	}
+	n.wg.Add(1)
+	go n.run()
+	return n
+}
+
+// Start subscribes n to the anomalies found in refreshes of the weather table, which it sends as alerts.
+func (n *Notifier) Start() {
+	weather.OnAnomaly(n.alert)
+}
+
+// Close stops n once the reports and alerts already queued are sent, or once ctx is done, when those not yet started
+// are dropped and ctx.Err() is returned.
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.jobs)
+	}
+	n.mu.Unlock()
+	finished := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		n.mu.Lock()
+		n.dropping = true
+		n.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for job := range n.jobs {
+		n.mu.Lock()
+		dropping := n.dropping
+		n.mu.Unlock()
+		if !dropping {
+			job()
+		}
+	}
+}
+
+// enqueue queues job to be run by the goroutine of n, dropping it if n is closed or too far behind.
+func (n *Notifier) enqueue(job func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.jobs <- job:
+	default:
+		log.Println("notify: queue full, dropping a notification")
+	}
+}
+
+// SendReport queues the daily report of day for the subscribers to reports.
+func (n *Notifier) SendReport(day time.Time) {
+	n.enqueue(func() { n.sendReport(day) })
+}
+
+// alert queues an alert about a for the subscribers to alerts about its channel, unless one was sent recently.
+func (n *Notifier) alert(a weather.Anomaly) {
+	n.mu.Lock()
+	throttled := throttle(n.lastAlert, a)
+	n.mu.Unlock()
+	if !throttled {
+		n.enqueue(func() { n.sendAlert(a) })
+	}
+}
+
+// Alerts returns the anomalies found at or after since that alerts are sent about, oldest first.
+func Alerts(since time.Time) []weather.Anomaly {
+	last := make(map[string]time.Time)
+	var alerts []weather.Anomaly
+	for _, a := range weather.Anomalies("", since) {
+		if !throttle(last, a) {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts
+}
+
+// throttle reports whether an alert about a is held back because one about its channel was sent within
+// alertInterval, given the times of the last alert about each channel in last, which it updates otherwise.
+func throttle(last map[string]time.Time, a weather.Anomaly) bool {
+	if t, ok := last[a.Channel]; ok && a.Datetime.Sub(t) < alertInterval {
+		return true
+	}
+	last[a.Channel] = a.Datetime
+	return false
+}
+
+// DescribeAlert returns the subject and text of the alert about a in loc. ok is false if a is not about a known
+// field.
+func DescribeAlert(a weather.Anomaly, loc *i18n.Locale) (subject, text string, ok bool) {
+	f, ok := weather.LookupField(a.Channel)
+	if !ok {
+		return "", "", false
+	}
+	channel := loc.T("channel." + a.Channel)
+	text = loc.T("alert.anomaly", channel, loc.Number(a.Value, 1), f.Unit,
+		loc.DateTime(a.Datetime.In(weather.StationTimezone)), loc.Number(a.Score, 1))
+	return loc.T("alert.subject", channel), text, true
+}
+
+// letter is the content of a message written once per locale and sent to every subscriber reading it.
+type letter struct {
+	subject string
+	text    string
+	html    string
+	chart   []byte
+}
+
+func (n *Notifier) sendReport(day time.Time) {
+	letters := make(map[*i18n.Locale]*letter)
+	for _, sub := range n.subscribers.All() {
+		if !sub.Reports {
+			continue
+		}
+		loc := subscriberLocale(sub)
+		m, ok := letters[loc]
+		if !ok {
+			var err error
+			if m, err = reportLetter(day, loc); err != nil {
+				log.Println("notify:", err)
+				return
+			}
+			letters[loc] = m
+		}
+		n.send(sub, loc, ScopeReports, m)
+	}
+}
+
+// reportLetter writes the report of day in loc.
+func reportLetter(day time.Time, loc *i18n.Locale) (*letter, error) {
+	d, err := report.NewDaily(day, loc)
+	if err != nil {
+		return nil, err
+	}
+	m := &letter{subject: d.T("report.title", loc.LongDate(d.Date))}
+	temperature, _ := weather.LookupField("Temperature")
+	if m.chart, err = renderChart(loc, temperature, d.Date, d.Overnight.To); err == nil {
+		d.Chart = "cid:" + chartID
+	} else if err != chart.ErrNoData {
+		return nil, err
+	}
+	var text, page bytes.Buffer
+	if err := d.Render(&text, "text"); err != nil {
+		return nil, err
+	}
+	if err := d.Render(&page, "html"); err != nil {
+		return nil, err
+	}
+	m.text, m.html = text.String(), page.String()
+	return m, nil
+}
+
+func (n *Notifier) sendAlert(a weather.Anomaly) {
+	f, ok := weather.LookupField(a.Channel)
+	if !ok {
+		return
+	}
+	letters := make(map[*i18n.Locale]*letter)
+	for _, sub := range n.subscribers.All() {
+		if !sub.wantsAlert(a.Channel) {
+			continue
+		}
+		loc := subscriberLocale(sub)
+		m, ok := letters[loc]
+		if !ok {
+			m = alertLetter(a, f, loc)
+			letters[loc] = m
+		}
+		n.send(sub, loc, ScopeAlerts, m)
+	}
+}
+
+// alertLetter writes the alert about a, a reading of f, in loc, with a chart of f over the day before it.
+func alertLetter(a weather.Anomaly, f weather.Field, loc *i18n.Locale) *letter {
+	subject, text, _ := DescribeAlert(a, loc)
+	m := &letter{subject: subject, text: text + "\n"}
+	m.html = "<!DOCTYPE html>\n<html><body>\n<p>" + html.EscapeString(text) + "</p>\n"
+	var err error
+	if m.chart, err = renderChart(loc, f, a.Datetime.Add(-24*time.Hour), a.Datetime.Add(time.Hour)); err == nil {
+		m.html += `<p><img src="cid:` + chartID + `" alt="` + html.EscapeString(loc.T("chart."+f.Column+".title")) +
+			`"></p>` + "\n"
+	} else if err != chart.ErrNoData {
+		log.Println("notify:", err)
+	}
+	m.html += "</body></html>\n"
+	return m
+}
+
+// send sends m to sub with a link unsubscribing them from scope.
+func (n *Notifier) send(sub Subscriber, loc *i18n.Locale, scope string, m *letter) {
+	link := n.unsubscribeURL(sub.Email, scope)
+	msg := &Message{
+		To:      sub.Email,
+		Subject: m.subject,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + link + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+		Text: m.text + "\n-- \n" + loc.T("email.unsubscribe", link) + "\n",
+		HTML: withFooter(m.html, `<p style="font-size: small; color: #666;"><a href="`+html.EscapeString(link)+`">`+
+			html.EscapeString(loc.T("email.unsubscribe_link"))+`</a></p>`),
+	}
+	if m.chart != nil {
+		msg.Inline = []Inline{{ContentID: chartID, ContentType: "image/png", Data: m.chart}}
+	}
+	if err := n.mailer.Send(msg); err != nil {
+		log.Println("notify:", sub.Email+":", err)
+	}
+}
+
+// unsubscribeURL returns the signed link unsubscribing email from scope.
+func (n *Notifier) unsubscribeURL(email, scope string) string {
+	query := url.Values{
+		"email": {email},
+		"scope": {scope},
+		"token": {UnsubscribeToken(n.secret, email, scope)},
+	}
+	return n.baseURL + "/unsubscribe?" + query.Encode()
+}
+
+// withFooter inserts footer at the end of the body of the HTML document page.
+func withFooter(page, footer string) string {
+	if i := strings.LastIndex(page, "</body>"); i >= 0 {
+		return page[:i] + footer + "\n" + page[i:]
+	}
+	return page + footer
+}
+
+// subscriberLocale returns the locale sub reads, the default if their language is not supported.
+func subscriberLocale(sub Subscriber) *i18n.Locale {
+	if loc, ok := i18n.Lookup(sub.Lang); ok {
+		return loc
+	}
+	return i18n.Default
+}
+
+// renderChart draws f from from to to as a PNG titled in loc.
+func renderChart(loc *i18n.Locale, f weather.Field, from, to time.Time) ([]byte, error) {
+	times, values, err := weather.ReadSeries(f, from, to, false)
+	if err != nil {
+		return nil, err
+	}
+	c := &chart.Chart{
+		Title:    loc.T("chart." + f.Column + ".title"),
+		XTitle:   loc.T("chart.time"),
+		YTitle:   loc.T("chart." + f.Column + ".axis"),
+		Times:    times,
+		Values:   values,
+		Width:    600,
+		Height:   300,
+		Location: weather.StationTimezone,
+		Locale:   loc,
+	}
+	var buf bytes.Buffer
+	if err := c.PNG(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
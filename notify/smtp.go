@@ -0,0 +1,89 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package notify
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// smtpTimeout bounds a whole SMTP session, from dialing the server to its reply to QUIT. It is a variable so that tests
+// can shorten it.
+var smtpTimeout = time.Minute
+
+// Mailer sends messages through the SMTP server at Addr, a host and port. Messages are sent From the given address
+// unless they have their own, authenticating with PLAIN when Username is set. The connection is upgraded with
+// STARTTLS when the server offers it; credentials are only sent over TLS or to localhost.
+type Mailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Send delivers msg to its recipient, giving up when the server takes longer than smtpTimeout.
+func (m *Mailer) Send(msg *Message) error {
+	if msg.From == "" {
+		msg.From = m.From
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return errors.New("notify: invalid sender \"" + msg.From + "\"")
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return errors.New("notify: invalid recipient \"" + msg.To + "\"")
+	}
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", m.Addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		// PlainAuth refuses to send the password unless the connection is TLS or to localhost.
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
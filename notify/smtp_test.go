@@ -0,0 +1,163 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package notify
+
+import (
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what a client sent to fakeSMTP in one session.
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP serves one SMTP session on a local port, offering AUTH PLAIN when auth is set, and returns the address it
+// listens on and a channel that receives the session once the client quits.
+func fakeSMTP(t *testing.T, auth bool) (string, <-chan smtpSession) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := textproto.NewConn(conn)
+		var s smtpSession
+		c.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg := line, ""
+			if i := strings.IndexByte(line, ' '); i >= 0 {
+				verb, arg = line[:i], line[i+1:]
+			}
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				if auth {
+					c.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+				} else {
+					c.PrintfLine("250 localhost")
+				}
+			case "AUTH":
+				s.auth = arg
+				c.PrintfLine("235 2.7.0 Authentication successful")
+			case "MAIL":
+				s.from = arg
+				c.PrintfLine("250 OK")
+			case "RCPT":
+				s.to = append(s.to, arg)
+				c.PrintfLine("250 OK")
+			case "DATA":
+				c.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				data, err := c.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				s.data = string(data)
+				c.PrintfLine("250 OK")
+			case "QUIT":
+				c.PrintfLine("221 Bye")
+				sessions <- s
+				return
+			default:
+				c.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+	return l.Addr().String(), sessions
+}
+
+func TestSend(t *testing.T) {
+	addr, sessions := fakeSMTP(t, false)
+	m := &Mailer{Addr: addr, From: "Chapelco <weather@example.com>"}
+	msg := &Message{To: "Someone <someone@example.org>", Subject: "Informe diario", Text: "Mínima: -2,5 °C\n"}
+	if err := m.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	s := <-sessions
+	if s.auth != "" {
+		t.Errorf("authenticated as %q without a username", s.auth)
+	}
+	if !strings.HasPrefix(s.from, "FROM:<weather@example.com>") {
+		t.Errorf("MAIL %s, want the address of the mailer", s.from)
+	}
+	if len(s.to) != 1 || s.to[0] != "TO:<someone@example.org>" {
+		t.Errorf("RCPT %v, want the address of the recipient", s.to)
+	}
+	received := readMessage(t, []byte(s.data))
+	if from := received.Header.Get("From"); from != "Chapelco <weather@example.com>" {
+		t.Errorf("message From %q, want the sender of the mailer", from)
+	}
+	if body := decodeBody(t, received.Body); body != msg.Text {
+		t.Errorf("body %q, want %q", body, msg.Text)
+	}
+}
+
+func TestSendAuth(t *testing.T) {
+	addr, sessions := fakeSMTP(t, true)
+	m := &Mailer{Addr: addr, From: "weather@example.com", Username: "station", Password: "secret"}
+	if err := m.Send(&Message{To: "someone@example.org", Text: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	s := <-sessions
+	want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00station\x00secret"))
+	if s.auth != want {
+		t.Errorf("AUTH %q, want %q", s.auth, want)
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The server accepts the connection but never greets.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second)
+	}()
+	defer func(timeout time.Duration) { smtpTimeout = timeout }(smtpTimeout)
+	smtpTimeout = 50 * time.Millisecond
+	m := &Mailer{Addr: l.Addr().String(), From: "weather@example.com"}
+	start := time.Now()
+	err = m.Send(&Message{To: "someone@example.org", Text: "hi"})
+	if err == nil {
+		t.Fatal("Send succeeded without a greeting")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Send gave up after %v, want about %v", elapsed, smtpTimeout)
+	}
+}
+
+func TestSendInvalidAddresses(t *testing.T) {
+	m := &Mailer{Addr: "127.0.0.1:1", From: "weather@example.com"}
+	for _, msg := range []*Message{
+		{From: "not an address", To: "someone@example.org"},
+		{To: "not an address"},
+	} {
+		if err := m.Send(msg); err == nil || !strings.HasPrefix(err.Error(), "notify: invalid") {
+			t.Errorf("Send from %q to %q returned %v", msg.From, msg.To, err)
+		}
+	}
+}
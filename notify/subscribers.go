@@ -0,0 +1,149 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Scopes of an unsubscribe link: the daily reports, the alerts or everything.
+const (
+	ScopeReports = "reports"
+	ScopeAlerts  = "alerts"
+	ScopeAll     = "all"
+)
+
+// Subscriber is someone who receives email and what they chose to receive: the daily Reports, Alerts about the
+// channels in Channels, or about every channel when it is empty, written in the language Lang, a tag understood by
+// i18n.Lookup.
+type Subscriber struct {
+	Email    string
+	Lang     string
+	Reports  bool
+	Alerts   bool
+	Channels []string `json:",omitempty"`
+}
+
+// wantsAlert reports whether s receives alerts about channel.
+func (s *Subscriber) wantsAlert(channel string) bool {
+	if !s.Alerts {
+		return false
+	}
+	if len(s.Channels) == 0 {
+		return true
+	}
+	for _, c := range s.Channels {
+		if strings.EqualFold(c, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribers is a list of subscribers kept in a JSON file, which operators may edit while the service runs. The
+// file is read again before every use, and rewritten when someone unsubscribes.
+type Subscribers struct {
+	path string
+	mu   sync.Mutex
+	list []Subscriber
+}
+
+// LoadSubscribers reads the subscribers in the file at path. A missing file is an empty list.
+func LoadSubscribers(path string) (*Subscribers, error) {
+	s := &Subscribers{path: path}
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// read replaces the list with the contents of the file. s.mu must be held.
+func (s *Subscribers) read() error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var list []Subscriber
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+	}
+	s.list = list
+	return nil
+}
+
+// All returns the subscribers in the file, or those last read from it when it cannot be read now.
+func (s *Subscribers) All() []Subscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.read()
+	return append([]Subscriber(nil), s.list...)
+}
+
+// Unsubscribe stops sending email to email in scope and saves the list, as read from the file so that edits made to
+// it since are kept. It reports whether email was subscribed. Subscribers left receiving nothing are removed.
+func (s *Subscribers) Unsubscribe(email, scope string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.read(); err != nil {
+		return false, err
+	}
+	for i := range s.list {
+		sub := &s.list[i]
+		if !strings.EqualFold(sub.Email, email) {
+			continue
+		}
+		if scope == ScopeReports || scope == ScopeAll {
+			sub.Reports = false
+		}
+		if scope == ScopeAlerts || scope == ScopeAll {
+			sub.Alerts = false
+		}
+		if !sub.Reports && !sub.Alerts {
+			s.list = append(s.list[:i], s.list[i+1:]...)
+		}
+		return true, s.save()
+	}
+	return false, nil
+}
+
+// save writes the list to its file. s.mu must be held.
+func (s *Subscribers) save() error {
+	data, err := json.MarshalIndent(s.list, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// ValidScope reports whether scope is one of the scopes of unsubscribe links.
+func ValidScope(scope string) bool {
+	return scope == ScopeReports || scope == ScopeAlerts || scope == ScopeAll
+}
+
+// UnsubscribeToken returns the token that authorizes unsubscribing email from scope: an HMAC-SHA256 of the address
+// and scope keyed with secret, so links cannot be forged for other addresses and need no stored state. Tokens do not
+// expire: a link keeps working for as long as secret is unchanged.
+func UnsubscribeToken(secret []byte, email, scope string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.ToLower(email) + "\n" + scope))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidUnsubscribeToken reports whether token authorizes unsubscribing email from scope.
+func ValidUnsubscribeToken(secret []byte, email, scope, token string) bool {
+	return hmac.Equal([]byte(token), []byte(UnsubscribeToken(secret, email, scope)))
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package notify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	secret := []byte("secret")
+	token := UnsubscribeToken(secret, "Someone@Example.org", ScopeAlerts)
+	if !ValidUnsubscribeToken(secret, "someone@example.org", ScopeAlerts, token) {
+		t.Error("token is not valid for the address in another case")
+	}
+	for _, test := range []struct {
+		secret       string
+		email, scope string
+	}{
+		{"other secret", "someone@example.org", ScopeAlerts},
+		{"secret", "other@example.org", ScopeAlerts},
+		{"secret", "someone@example.org", ScopeAll},
+		{"secret", "someone@example.org\nall", ""},
+	} {
+		if ValidUnsubscribeToken([]byte(test.secret), test.email, test.scope, token) {
+			t.Errorf("token is valid with secret %q for %q in scope %q", test.secret, test.email, test.scope)
+		}
+	}
+	if ValidUnsubscribeToken(secret, "someone@example.org", ScopeAlerts, token[1:]) {
+		t.Error("truncated token is valid")
+	}
+}
+
+// writeSubscribers writes list to the file at path.
+func writeSubscribers(t *testing.T, path, list string) {
+	if err := ioutil.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subscribers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subscribers.json")
+	writeSubscribers(t, path, `[
+		{"Email": "a@example.org", "Lang": "en", "Reports": true, "Alerts": true},
+		{"Email": "b@example.org", "Lang": "es", "Reports": true}
+	]`)
+	s, err := LoadSubscribers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An operator adds a subscriber while the service runs.
+	writeSubscribers(t, path, `[
+		{"Email": "a@example.org", "Lang": "en", "Reports": true, "Alerts": true},
+		{"Email": "b@example.org", "Lang": "es", "Reports": true},
+		{"Email": "c@example.org", "Lang": "es", "Alerts": true, "Channels": ["Wind"]}
+	]`)
+	if all := s.All(); len(all) != 3 {
+		t.Errorf("%d subscribers after the file was edited, want 3", len(all))
+	}
+	writeSubscribers(t, path, `[
+		{"Email": "a@example.org", "Lang": "en", "Reports": true, "Alerts": true},
+		{"Email": "b@example.org", "Lang": "es", "Reports": true},
+		{"Email": "c@example.org", "Lang": "es", "Alerts": true, "Channels": ["Wind"]},
+		{"Email": "d@example.org", "Lang": "en", "Reports": true}
+	]`)
+
+	if ok, err := s.Unsubscribe("A@example.org", ScopeReports); !ok || err != nil {
+		t.Fatalf("Unsubscribe returned %v, %v", ok, err)
+	}
+	if ok, err := s.Unsubscribe("b@example.org", ScopeAll); !ok || err != nil {
+		t.Fatalf("Unsubscribe returned %v, %v", ok, err)
+	}
+	if ok, err := s.Unsubscribe("nobody@example.org", ScopeAll); ok || err != nil {
+		t.Errorf("Unsubscribe of an unknown address returned %v, %v", ok, err)
+	}
+	want := []Subscriber{
+		{Email: "a@example.org", Lang: "en", Alerts: true},
+		{Email: "c@example.org", Lang: "es", Alerts: true, Channels: []string{"Wind"}},
+		{Email: "d@example.org", Lang: "en", Reports: true},
+	}
+	reloaded, err := LoadSubscribers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.All(); !reflect.DeepEqual(got, want) {
+		t.Errorf("saved %+v, want %+v", got, want)
+	}
+
+	// A file that cannot be read leaves the last list in use and is not overwritten.
+	writeSubscribers(t, path, `[{"Email": `)
+	if got := s.All(); !reflect.DeepEqual(got, want) {
+		t.Errorf("%+v after the file was broken, want %+v", got, want)
+	}
+	if _, err := s.Unsubscribe("a@example.org", ScopeAll); err == nil {
+		t.Error("Unsubscribe saved over a broken file")
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != `[{"Email": ` {
+		t.Errorf("broken file was rewritten as %s", data)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package openapi builds OpenAPI 3 documents describing JSON APIs. Response schemas are generated by reflection from
+// the Go types the handlers encode, so the document cannot drift from what is served.
+package openapi
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the OpenAPI version of the documents built.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document. Build it with NewDocument and Add, then encode it as JSON.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Servers    []Server                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a base URL the API is served from.
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Operation describes one route for Add. Response is a value of the type the route encodes as JSON, a OneOf of such
+// values, or nil for routes serving another ContentType. ContentType defaults to application/json.
+type Operation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	Parameters  []Parameter
+	Response    interface{}
+	ContentType string
+}
+
+// OneOf is the Response of routes that encode values of one of several types, for example depending on a parameter.
+type OneOf []interface{}
+
+// Parameter describes a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Schema is a JSON schema as used by OpenAPI.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+type operation struct {
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type response struct {
+	Description string                `json:"description"`
+	Content     map[string]*mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// NewDocument returns an empty document for the API info served from server.
+func NewDocument(info Info, server string) *Document {
+	d := &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]map[string]*operation),
+		Components: components{Schemas: make(map[string]*Schema)},
+	}
+	if server != "" {
+		d.Servers = []Server{{server}}
+	}
+	return d
+}
+
+// Add describes op in d. It fails if the path parameters in op.Path and op.Parameters disagree, if the route is
+// already described or if the response type cannot be encoded as JSON.
+func (d *Document) Add(op Operation) error {
+	method := strings.ToLower(op.Method)
+	if method == "" {
+		method = "get"
+	}
+	if d.Paths[op.Path][method] != nil {
+		return errors.New("openapi: " + op.Method + " " + op.Path + " described twice")
+	}
+	declared := make(map[string]bool)
+	for _, p := range op.Parameters {
+		if p.In == "path" {
+			declared[p.Name] = true
+		}
+	}
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		if !declared[match[1]] {
+			return errors.New("openapi: " + op.Path + " does not describe path parameter " + match[1])
+		}
+		delete(declared, match[1])
+	}
+	for name := range declared {
+		return errors.New("openapi: " + op.Path + " has no path parameter " + name)
+	}
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	ok := &response{Description: "OK", Content: map[string]*mediaType{contentType: {}}}
+	if op.Response != nil {
+		schema, err := d.responseSchema(op.Response)
+		if err != nil {
+			return errors.New("openapi: " + op.Path + ": " + err.Error())
+		}
+		ok.Content[contentType].Schema = schema
+	}
+	if d.Paths[op.Path] == nil {
+		d.Paths[op.Path] = make(map[string]*operation)
+	}
+	d.Paths[op.Path][method] = &operation{
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Parameters:  op.Parameters,
+		Responses: map[string]*response{
+			"200":     ok,
+			"400":     {Description: "Invalid parameters", Content: textContent()},
+			"default": {Description: "Error", Content: textContent()},
+		},
+	}
+	return nil
+}
+
+// responseSchema returns the schema of response, the Response of an Operation.
+func (d *Document) responseSchema(response interface{}) (*Schema, error) {
+	alternatives, ok := response.(OneOf)
+	if !ok {
+		return d.schemaFor(reflect.TypeOf(response))
+	}
+	schema := &Schema{OneOf: make([]*Schema, len(alternatives))}
+	for i, v := range alternatives {
+		var err error
+		if schema.OneOf[i], err = d.schemaFor(reflect.TypeOf(v)); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// textContent describes the plain text error messages of failed requests.
+func textContent() map[string]*mediaType {
+	return map[string]*mediaType{"text/plain": {Schema: &Schema{Type: "string"}}}
+}
+
+// schemaFor returns the schema of values of type t encoded by encoding/json. Named struct types are added to the
+// document's components and referenced.
+func (d *Document) schemaFor(t reflect.Type) (*Schema, error) {
+	if t == reflect.TypeOf(time.Time{}) {
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema, err := d.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if schema.Ref != "" {
+			// Siblings of $ref are ignored, so a nullable reference needs a wrapper.
+			return &Schema{AllOf: []*Schema{schema}, Nullable: true}, nil
+		}
+		schema.Nullable = true
+		return schema, nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}, nil
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}, nil
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}, nil
+		}
+		items, err := d.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items, Nullable: t.Kind() == reflect.Slice}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, errors.New("map key " + t.Key().String() + " cannot be encoded as JSON")
+		}
+		values, err := d.schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		// Component names are capitalized since unexported types describe public responses too.
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		// The schema is added before its fields are described so that recursive types end in a reference.
+		if _, ok := d.Components.Schemas[name]; ok {
+			return ref, nil
+		}
+		d.Components.Schemas[name] = nil
+		schema, err := d.structSchema(t)
+		if err != nil {
+			delete(d.Components.Schemas, name)
+			return nil, err
+		}
+		d.Components.Schemas[name] = schema
+		return ref, nil
+	}
+	return nil, errors.New(t.String() + " cannot be encoded as JSON")
+}
+
+// structSchema returns the object schema of struct type t, following the field naming rules of encoding/json.
+func (d *Document) structSchema(t reflect.Type) (*Schema, error) {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma:]
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded, err := d.structSchema(ft)
+				if err != nil {
+					return nil, err
+				}
+				for n, p := range embedded.Properties {
+					if _, shadowed := schema.Properties[n]; !shadowed {
+						schema.Properties[n] = p
+					}
+				}
+				schema.Required = append(schema.Required, embedded.Required...)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		property, err := d.schemaFor(f.Type)
+		if err != nil {
+			return nil, errors.New(t.Name() + "." + f.Name + ": " + err.Error())
+		}
+		if strings.Contains(options, ",string") {
+			property = &Schema{Type: "string"}
+		}
+		schema.Properties[name] = property
+		if !strings.Contains(options, ",omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema, nil
+}
+
+// QueryParam returns an optional query parameter of the given JSON schema type, such as "integer" or "string".
+func QueryParam(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: typ}}
+}
+
+// PathParam returns a path parameter of the given JSON schema type.
+func PathParam(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &Schema{Type: typ}}
+}
+
+// EnumParam returns an optional string query parameter taking one of values.
+func EnumParam(name, description string, values ...string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: "string", Enum: values}}
+}
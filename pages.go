@@ -0,0 +1,104 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/publish"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// templatesDir holds the html/template files of the server rendered pages, set from TemplatesDir.
+var templatesDir = "templates"
+
+// pageTemplates are the templates of the server rendered pages, parsed by loadPageTemplates.
+var pageTemplates *template.Template
+
+// conditionsPage is the data the conditions page and widget templates are executed with.
+type conditionsPage struct {
+	Locale      *i18n.Locale
+	BaseURL     string
+	Observation *publish.Observation
+	Today       *weather.DailySummary
+	Sun         weather.SunTimes
+}
+
+// loadPageTemplates parses the templates of the server rendered pages, stopping the server if any is invalid.
+func loadPageTemplates() {
+	funcs := template.FuncMap{
+		"local": func(t time.Time) time.Time { return t.In(weather.StationTimezone) },
+	}
+	var err error
+	pageTemplates, err = template.New("").Funcs(funcs).ParseGlob(filepath.Join(templatesDir, "*.html"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readConditionsPage reads the current conditions to render for r.
+func readConditionsPage(r *http.Request) *conditionsPage {
+	page := &conditionsPage{
+		Locale:  localeRequested(r),
+		BaseURL: baseURL(r),
+		Sun:     weather.SunTimesOn(time.Now()),
+	}
+	if record := weather.ReadCurrentWeatherRecord(false); record != nil {
+		page.Observation = publish.NewObservation(*record)
+		page.Today = weather.ReadDailySummary(record.Datetime)
+	}
+	return page
+}
+
+// conditionsPageHandler renders the current conditions as a page for clients that do not run the web app.
+func conditionsPageHandler(w http.ResponseWriter, r *http.Request) {
+	page := readConditionsPage(r)
+	renderPage(w, "conditions", page.Locale, page)
+}
+
+// widgetHandler renders the current conditions as a small document meant to be embedded in an iframe.
+func widgetHandler(w http.ResponseWriter, r *http.Request) {
+	page := readConditionsPage(r)
+	renderPage(w, "widget", page.Locale, page)
+}
+
+// widgetSnippetHandler renders the widget as an HTML fragment for other sites to include in their own pages.
+func widgetSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	page := readConditionsPage(r)
+	renderPage(w, "widget-card", page.Locale, page)
+}
+
+// renderPage executes the template name with page, written in loc, as the response.
+func renderPage(w http.ResponseWriter, name string, loc *i18n.Locale, page interface{}) {
+	var buf bytes.Buffer
+	if err := pageTemplates.ExecuteTemplate(&buf, name, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", loc.Tag)
+	addVary(w.Header(), "Accept-Language")
+	buf.WriteTo(w)
+}
+
+// baseURL returns PublicURL without a trailing slash, for links that must work from other sites. When PublicURL is
+// not set it falls back to the scheme and host r was made to, which a client can choose.
+func baseURL(r *http.Request) string {
+	if cfg.PublicURL != "" {
+		return strings.TrimRight(cfg.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,96 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// pageCursor is where a page of observations starts: the records after Datetime when walking forward in time, the
+// records before it otherwise. Clients only see it encoded, so its format can change.
+type pageCursor struct {
+	Datetime time.Time
+	Forward  bool
+}
+
+// encode returns c as an opaque string.
+func (c pageCursor) encode() string {
+	direction := "b"
+	if c.Forward {
+		direction = "f"
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + strconv.FormatInt(c.Datetime.UnixNano(), 10)))
+}
+
+// decodeCursor parses a cursor made by encode.
+func decodeCursor(s string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) < 2 || (data[0] != 'b' && data[0] != 'f') {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(string(data[1:]), 10, 64)
+	if err != nil {
+		return pageCursor{}, errors.New("invalid cursor")
+	}
+	return pageCursor{time.Unix(0, nanos).UTC(), data[0] == 'f'}, nil
+}
+
+// cursorRequested returns where the requested page starts: the cursor parameter of r, else the records from the from
+// parameter on, else the latest records.
+func cursorRequested(r *http.Request) (pageCursor, error) {
+	if cursor := r.FormValue("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return c, errors.New(localeRequested(r).T("error.invalid_cursor"))
+		}
+		return c, nil
+	}
+	from, err := parseTimeParam(r, "from", time.Time{})
+	if err != nil || from.IsZero() {
+		return pageCursor{}, err
+	}
+	return pageCursor{from.Add(-time.Nanosecond), true}, nil
+}
+
+// setPageLinks adds a Link header to the response with the URLs of the pages continuing the walk, rel="next", and
+// going back, rel="prev", when there are any.
+func setPageLinks(w http.ResponseWriter, r *http.Request, cursor pageCursor, info weather.PageInfo) {
+	link := func(c pageCursor, rel string) string {
+		query := r.URL.Query()
+		query.Del("from")
+		query.Set("cursor", c.encode())
+		return "<" + r.URL.Path + "?" + query.Encode() + `>; rel="` + rel + `"`
+	}
+	older, newer := pageCursor{info.First, false}, pageCursor{info.Last, true}
+	if info.First.IsZero() {
+		// An empty page past either end of the history continues from where it was asked to start.
+		older, newer = pageCursor{cursor.Datetime, false}, pageCursor{cursor.Datetime, true}
+	}
+	var links []string
+	if cursor.Forward {
+		if info.Newer {
+			links = append(links, link(newer, "next"))
+		}
+		if info.Older {
+			links = append(links, link(older, "prev"))
+		}
+	} else {
+		if info.Older {
+			links = append(links, link(older, "next"))
+		}
+		if info.Newer {
+			links = append(links, link(newer, "prev"))
+		}
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
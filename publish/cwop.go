@@ -0,0 +1,118 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package publish
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// CWOPServer is the Citizen Weather Observer Program APRS-IS server.
+const CWOPServer = "cwop.aprs.net:14580"
+
+// CWOP asks for current observations no more often than every 5 minutes. Observations reach the server only when the
+// weather table is refreshed, so those up to an hour old still count as current.
+const (
+	cwopMaxAge   = time.Hour
+	cwopInterval = 5 * time.Minute
+)
+
+// CWOP uploads observations to the Citizen Weather Observer Program as APRS weather reports over an APRS-IS TCP
+// connection, logging in for each one. Server defaults to CWOPServer and Passcode to -1, the passcode of stations
+// without an amateur radio license. As a LivePublisher it is only sent the newest observation, so that a backlog
+// after downtime is not replayed.
+type CWOP struct {
+	Server   string
+	Callsign string
+	Passcode string
+}
+
+func (p *CWOP) Name() string {
+	return "cwop"
+}
+
+func (p *CWOP) Limits() (maxAge, interval time.Duration) {
+	return cwopMaxAge, cwopInterval
+}
+
+func (p *CWOP) Publish(obs *Observation) error {
+	server := p.Server
+	if server == "" {
+		server = CWOPServer
+	}
+	passcode := p.Passcode
+	if passcode == "" {
+		passcode = "-1"
+	}
+	conn, err := net.DialTimeout("tcp", server, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+	// The server greets with a comment line, then acknowledges the login with another.
+	if _, err := r.ReadString('\n'); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "user %s pass %s vers chapelco-weather 1.0\r\n", p.Callsign, passcode); err != nil {
+		return err
+	}
+	if _, err := r.ReadString('\n'); err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(conn, aprsPacket(p.Callsign, obs)+"\r\n")
+	return err
+}
+
+// aprsPacket returns the APRS positioned weather report for obs from callsign. Wind is not measured and is reported
+// as missing.
+func aprsPacket(callsign string, obs *Observation) string {
+	humidity := int(math.Floor(obs.RelativeHumidity + 0.5))
+	if humidity >= 100 {
+		humidity = 0
+	}
+	return fmt.Sprintf("%s>APRS,TCPIP*:@%sz%s/%s_.../...g...t%sr%03dp%03dP%03dh%02db%05d",
+		callsign,
+		obs.Datetime.UTC().Format("021504"),
+		aprsCoordinate(weather.StationLatitude, 2, "N", "S"),
+		aprsCoordinate(weather.StationLongitude, 3, "E", "W"),
+		aprsTemperature(fahrenheit(obs.Temperature)),
+		hundredthsOfInch(obs.RainLastHour),
+		hundredthsOfInch(obs.RainLastDay),
+		hundredthsOfInch(obs.RainToday),
+		humidity,
+		int(math.Floor(obs.SeaLevelPressure*10+0.5)))
+}
+
+// aprsCoordinate formats degrees as APRS degrees and decimal minutes with the given number of degree digits, followed
+// by the hemisphere.
+func aprsCoordinate(degrees float64, digits int, positive, negative string) string {
+	hemisphere := positive
+	if degrees < 0 {
+		hemisphere, degrees = negative, -degrees
+	}
+	// Round to hundredths of a minute before splitting, so that 59.996 minutes carry into the degrees.
+	hundredths := int(math.Floor(degrees*6000 + 0.5))
+	return fmt.Sprintf("%0*d%02d.%02d%s", digits, hundredths/6000, hundredths%6000/100, hundredths%100, hemisphere)
+}
+
+// aprsTemperature formats a temperature in °F as the three characters APRS allows.
+func aprsTemperature(f float64) string {
+	rounded := int(math.Floor(f + 0.5))
+	if rounded < 0 {
+		return fmt.Sprintf("-%02d", -rounded)
+	}
+	return fmt.Sprintf("%03d", rounded)
+}
+
+// hundredthsOfInch converts mm of rain to the hundredths of an inch APRS reports, capped to three digits.
+func hundredthsOfInch(mm float64) int {
+	return int(math.Min(math.Floor(mm/25.4*100+0.5), 999))
+}
@@ -0,0 +1,129 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package publish
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// testObservation is an observation with every value reported by the upload protocols set.
+var testObservation = &Observation{
+	WeatherRecord: weather.WeatherRecord{
+		Datetime:         time.Date(2014, 7, 1, 12, 15, 0, 0, time.UTC),
+		Temperature:      -2.5,
+		DewPoint:         -4,
+		RelativeHumidity: 85.4,
+		SeaLevelPressure: 1013.2,
+	},
+	RainLastHour: 1.27,
+	RainLastDay:  2.54,
+}
+
+// fakeAPRSIS serves one APRS-IS login on a local port, greeting clients unless greet is false, and returns the
+// address it listens on and a channel that receives the lines the client sent.
+func fakeAPRSIS(t *testing.T, greet bool) (string, <-chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := make(chan []string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if !greet {
+			return
+		}
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("# aprsc 2.1.4\r\n"))
+		var lines []string
+		for len(lines) < 2 {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			lines = append(lines, line)
+			if len(lines) == 1 {
+				conn.Write([]byte("# logresp CW0001 unverified, server T2TEST\r\n"))
+			}
+		}
+		sessions <- lines
+	}()
+	return l.Addr().String(), sessions
+}
+
+func TestCWOPPublish(t *testing.T) {
+	addr, sessions := fakeAPRSIS(t, true)
+	p := &CWOP{Server: addr, Callsign: "CW0001"}
+	if err := p.Publish(testObservation); err != nil {
+		t.Fatal(err)
+	}
+	lines := <-sessions
+	want := []string{
+		"user CW0001 pass -1 vers chapelco-weather 1.0\r\n",
+		"CW0001>APRS,TCPIP*:@011215z4015.00S/07112.60W_.../...g...t028r005p010P000h85b10132\r\n",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("sent %q, want %q", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d is %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
+
+func TestCWOPPublishWithoutGreeting(t *testing.T) {
+	addr, _ := fakeAPRSIS(t, false)
+	p := &CWOP{Server: addr, Callsign: "CW0001"}
+	if err := p.Publish(testObservation); err == nil {
+		t.Error("Publish succeeded although the server closed the connection")
+	}
+}
+
+func TestAPRSPacket(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		temperature float64
+		humidity    float64
+		want        string
+	}{
+		{"below 0 °F", -20, 50, "t-04"},
+		{"saturated", 10, 99.6, "h00"},
+		{"dry", 25, 5, "h05"},
+	} {
+		obs := *testObservation
+		obs.Temperature, obs.RelativeHumidity = test.temperature, test.humidity
+		if packet := aprsPacket("CW0001", &obs); !strings.Contains(packet, test.want) {
+			t.Errorf("%s: packet %q does not contain %q", test.name, packet, test.want)
+		}
+	}
+}
+
+func TestAPRSCoordinate(t *testing.T) {
+	for _, test := range []struct {
+		degrees            float64
+		digits             int
+		positive, negative string
+		want               string
+	}{
+		{-40.25, 2, "N", "S", "4015.00S"},
+		{-71.21, 3, "E", "W", "07112.60W"},
+		{12.99999, 2, "N", "S", "1300.00N"},
+		{0, 3, "E", "W", "00000.00E"},
+	} {
+		if got := aprsCoordinate(test.degrees, test.digits, test.positive, test.negative); got != test.want {
+			t.Errorf("aprsCoordinate(%v, %d) = %q, want %q", test.degrees, test.digits, got, test.want)
+		}
+	}
+}
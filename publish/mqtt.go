@@ -0,0 +1,89 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package publish
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/mqtt"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// MQTT publishes observations to an MQTT broker under Topic, which defaults to "weather/" followed by the station
+// name. Each record is published as JSON to Topic itself and, retained, to Topic/current; each channel's value is
+// published retained to Topic/<channel>, such as weather/chapelco/dew_point. QoS is 0 or 1.
+type MQTT struct {
+	Options mqtt.Options
+	Topic   string
+	QoS     byte
+	client  *mqtt.Client
+}
+
+// channelMessage is the payload published to a channel topic.
+type channelMessage struct {
+	Datetime time.Time
+	Value    float64
+	Unit     string
+}
+
+func (p *MQTT) Name() string {
+	return "mqtt"
+}
+
+// Publish sends obs, connecting to the broker first if needed. The connection is kept for later observations unless
+// publishing fails, in which case the next attempt reconnects.
+func (p *MQTT) Publish(obs *Observation) error {
+	if p.client == nil {
+		client, err := mqtt.Dial(p.Options)
+		if err != nil {
+			return err
+		}
+		p.client = client
+	}
+	if err := p.publish(obs); err != nil {
+		p.client.Close()
+		p.client = nil
+		return err
+	}
+	return nil
+}
+
+// Close disconnects from the broker.
+func (p *MQTT) Close() error {
+	if p.client == nil {
+		return nil
+	}
+	err := p.client.Close()
+	p.client = nil
+	return err
+}
+
+func (p *MQTT) publish(obs *Observation) error {
+	topic := p.Topic
+	if topic == "" {
+		topic = "weather/" + weather.StationName
+	}
+	record, err := json.Marshal(obs.WeatherRecord)
+	if err != nil {
+		return err
+	}
+	if err := p.client.Publish(topic, record, p.QoS, false); err != nil {
+		return err
+	}
+	if err := p.client.Publish(topic+"/current", record, p.QoS, true); err != nil {
+		return err
+	}
+	for _, f := range weather.Fields[1:] {
+		value, _ := f.Value(&obs.WeatherRecord).(float64)
+		message, err := json.Marshal(channelMessage{obs.Datetime, value, f.Unit})
+		if err != nil {
+			return err
+		}
+		if err := p.client.Publish(topic+"/"+f.SnakeName(), message, p.QoS, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package publish pushes new observations from the weather station to outside networks such as Weather Underground
+// and the Citizen Weather Observer Program.
+package publish
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// Retry delays for each publisher, variables so that tests can shorten them.
+var (
+	minRetryDelay = 30 * time.Second
+	maxRetryDelay = 30 * time.Minute
+)
+
+// maxPending is how many observations are queued for each publisher.
+const maxPending = 500
+
+// Publisher sends observations to one outside network.
+type Publisher interface {
+	Name() string
+	Publish(obs *Observation) error
+}
+
+// LivePublisher is a Publisher to a network that only takes current observations at a limited rate, such as CWOP.
+// Only the newest observation queued for it is sent, observations older than maxAge by then are skipped instead, and
+// uploads are spaced at least interval apart.
+type LivePublisher interface {
+	Publisher
+	Limits() (maxAge, interval time.Duration)
+}
+
+// Observation is a WeatherRecord with the rain totals upload protocols ask for, all in mm: over the last hour, the
+// last 24 hours and since local midnight.
+type Observation struct {
+	weather.WeatherRecord
+	RainLastHour float64
+	RainLastDay  float64
+	RainToday    float64
+}
+
+// NewObservation returns record with its rain totals read from the cached table.
+func NewObservation(record weather.WeatherRecord) *Observation {
+	t := record.Datetime
+	return &Observation{
+		WeatherRecord: record,
+		RainLastHour:  weather.ReadRainBetween(t.Add(-time.Hour), t),
+		RainLastDay:   weather.ReadRainBetween(t.Add(-24*time.Hour), t),
+		RainToday:     weather.ReadRainBetween(weather.LocalMidnight(t), t),
+	}
+}
+
+// Dispatcher queues new observations for each of its publishers and sends them in order from a goroutine per
+// publisher, retrying failures with exponential backoff. The Datetime of the last observation each publisher accepted
+// is its cursor: older or repeated observations are never queued again, and cursors are saved to a file so that
+// restarts neither repeat nor skip uploads.
+type Dispatcher struct {
+	path    string
+	mu      sync.Mutex
+	cursors map[string]time.Time
+	queues  []*queue
+	wg      sync.WaitGroup
+}
+
+// queue holds the observations waiting to be sent by one publisher. last is the Datetime of the newest observation
+// queued or sent. maxAge and interval are the limits of a LivePublisher, zero for other publishers, and sent is when
+// the publisher was last called.
+type queue struct {
+	publisher Publisher
+	pending   []*Observation
+	last      time.Time
+	maxAge    time.Duration
+	interval  time.Duration
+	sent      time.Time
+	wake      chan struct{}
+	stop      chan struct{}
+}
+
+// NewDispatcher returns a Dispatcher for publishers keeping its cursors in the file at path, which is created when
+// missing. An empty path keeps cursors in memory only.
+func NewDispatcher(path string, publishers ...Publisher) (*Dispatcher, error) {
+	d := &Dispatcher{path: path, cursors: make(map[string]time.Time)}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &d.cursors); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, p := range publishers {
+		q := &queue{publisher: p, last: d.cursors[p.Name()], wake: make(chan struct{}, 1), stop: make(chan struct{})}
+		if live, ok := p.(LivePublisher); ok {
+			q.maxAge, q.interval = live.Limits()
+		}
+		d.queues = append(d.queues, q)
+		d.wg.Add(1)
+		go d.run(q)
+	}
+	return d, nil
+}
+
+// Start subscribes d to the records brought in by each refresh of the weather table. The first load brings in the
+// records since the oldest cursor, so that observations recorded while the server was down are uploaded too.
+func (d *Dispatcher) Start() {
+	var since time.Time
+	for _, q := range d.queues {
+		if !q.last.IsZero() && (since.IsZero() || q.last.Before(since)) {
+			since = q.last
+		}
+	}
+	weather.OnNewRecordsSince(since, d.Enqueue)
+}
+
+// Enqueue queues the records newer than each publisher's cursor. A publisher without a cursor starts from the newest
+// record rather than uploading the backlog, as does a LivePublisher every time.
+func (d *Dispatcher) Enqueue(records []weather.WeatherRecord) {
+	if len(records) == 0 {
+		return
+	}
+	observations := make(map[time.Time]*Observation)
+	observation := func(r weather.WeatherRecord) *Observation {
+		if obs, ok := observations[r.Datetime]; ok {
+			return obs
+		}
+		obs := NewObservation(r)
+		observations[r.Datetime] = obs
+		return obs
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, q := range d.queues {
+		start := 0
+		if q.last.IsZero() {
+			start = len(records) - 1
+		}
+		for _, r := range records[start:] {
+			if !r.Datetime.After(q.last) {
+				continue
+			}
+			q.pending = append(q.pending, observation(r))
+			q.last = r.Datetime
+		}
+		if q.maxAge > 0 && len(q.pending) > 1 {
+			q.pending = q.pending[len(q.pending)-1:]
+		}
+		if len(q.pending) > maxPending {
+			log.Println("publish:", q.publisher.Name(), "dropped", len(q.pending)-maxPending, "queued observations")
+			q.pending = q.pending[len(q.pending)-maxPending:]
+		}
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close stops every publisher once the observation it is sending, if any, is done, closes the publishers that hold a
+// connection and saves the cursors. Queued observations that were not sent are picked up again after a restart since
+// the cursors were not advanced past them.
+func (d *Dispatcher) Close() error {
+	for _, q := range d.queues {
+		close(q.stop)
+	}
+	d.wg.Wait()
+	for _, q := range d.queues {
+		if c, ok := q.publisher.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.save()
+}
+
+// run sends the observations queued in q until it is stopped. Observations of a LivePublisher that are too old are
+// skipped, advancing its cursor as if they had been sent so that they are not picked up again after a restart.
+func (d *Dispatcher) run(q *queue) {
+	defer d.wg.Done()
+	delay := minRetryDelay
+	for {
+		d.mu.Lock()
+		var obs *Observation
+		if len(q.pending) > 0 {
+			obs = q.pending[0]
+		}
+		d.mu.Unlock()
+		if obs == nil {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.stop:
+				return
+			}
+		}
+		if q.maxAge > 0 && time.Since(obs.Datetime) > q.maxAge {
+			log.Println("publish:", q.publisher.Name(), "skipped the observation of", obs.Datetime, "as too old")
+			d.done(q, obs)
+			continue
+		}
+		if wait := q.sent.Add(q.interval).Sub(time.Now()); q.interval > 0 && wait > 0 {
+			// Wait out the interval, then send whichever observation is newest by then.
+			select {
+			case <-time.After(wait):
+				continue
+			case <-q.stop:
+				return
+			}
+		}
+		q.sent = time.Now()
+		if err := q.publisher.Publish(obs); err != nil {
+			log.Println("publish:", q.publisher.Name(), err)
+			select {
+			case <-time.After(delay):
+			case <-q.stop:
+				return
+			}
+			if delay *= 2; delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+			continue
+		}
+		delay = minRetryDelay
+		d.done(q, obs)
+	}
+}
+
+// done removes obs from the front of q, unless newer observations replaced it, and advances the cursor of q to it.
+func (d *Dispatcher) done(q *queue, obs *Observation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(q.pending) > 0 && q.pending[0] == obs {
+		q.pending = q.pending[1:]
+	}
+	d.cursors[q.publisher.Name()] = obs.Datetime
+	if err := d.save(); err != nil {
+		log.Println("publish:", err)
+	}
+}
+
+// save writes the cursors to the cursor file. d.mu must be held.
+func (d *Dispatcher) save() error {
+	if d.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(d.cursors)
+	if err != nil {
+		return err
+	}
+	tmp := d.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
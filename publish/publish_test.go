@@ -0,0 +1,223 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package publish
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+func init() {
+	// Observations read their rain totals from the weather table, which the tests leave unreadable.
+	weather.DataURL = filepath.Join(os.TempDir(), "missing-chapelco-weather.dbf")
+	minRetryDelay, maxRetryDelay = 10*time.Millisecond, 20*time.Millisecond
+}
+
+// attempt is a call to fakePublisher.Publish.
+type attempt struct {
+	datetime time.Time
+	at       time.Time
+}
+
+// fakePublisher records its calls on a channel, failing the first failures of them. maxAge and interval make it a
+// LivePublisher when set.
+type fakePublisher struct {
+	failures int
+	maxAge   time.Duration
+	interval time.Duration
+	attempts chan attempt
+}
+
+func newFakePublisher(failures int) *fakePublisher {
+	return &fakePublisher{failures: failures, attempts: make(chan attempt, 100)}
+}
+
+func (p *fakePublisher) Name() string {
+	return "fake"
+}
+
+func (p *fakePublisher) Publish(obs *Observation) error {
+	p.attempts <- attempt{obs.Datetime, time.Now()}
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("publish: unavailable")
+	}
+	return nil
+}
+
+// livePublisher is a fakePublisher with limits.
+type livePublisher struct {
+	*fakePublisher
+}
+
+func (p livePublisher) Limits() (time.Duration, time.Duration) {
+	return p.maxAge, p.interval
+}
+
+// next returns the next call to p, failing t if there is none within a second.
+func (p *fakePublisher) next(t *testing.T) attempt {
+	select {
+	case a := <-p.attempts:
+		return a
+	case <-time.After(time.Second):
+		t.Fatal("no observation was published")
+	}
+	return attempt{}
+}
+
+// expectNone fails t if p is called within wait.
+func (p *fakePublisher) expectNone(t *testing.T, wait time.Duration) {
+	select {
+	case a := <-p.attempts:
+		t.Errorf("published the observation of %v", a.datetime)
+	case <-time.After(wait):
+	}
+}
+
+// records returns records recorded at each of times.
+func records(times ...time.Time) []weather.WeatherRecord {
+	list := make([]weather.WeatherRecord, len(times))
+	for i, t := range times {
+		list[i].Datetime = t
+	}
+	return list
+}
+
+// cursorDispatcher returns a Dispatcher for p with its cursor at cursor, kept in a file under dir.
+func cursorDispatcher(t *testing.T, dir string, cursor time.Time, p Publisher) (*Dispatcher, string) {
+	path := filepath.Join(dir, "cursors.json")
+	data, err := json.Marshal(map[string]time.Time{"fake": cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDispatcher(path, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, path
+}
+
+// savedCursor returns the cursor saved in the file at path.
+func savedCursor(t *testing.T, path string) time.Time {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursors map[string]time.Time
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		t.Fatal(err)
+	}
+	return cursors["fake"]
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	t0 := time.Date(2014, 7, 1, 12, 0, 0, 0, time.UTC)
+	p := newFakePublisher(2)
+	d, path := cursorDispatcher(t, dir, t0, p)
+	d.Enqueue(records(t0.Add(-20*time.Minute), t0, t0.Add(20*time.Minute), t0.Add(40*time.Minute)))
+
+	// The first observation after the cursor fails twice, waiting twice as long before the second retry.
+	first, second, third := p.next(t), p.next(t), p.next(t)
+	for i, a := range []attempt{first, second, third} {
+		if !a.datetime.Equal(t0.Add(20 * time.Minute)) {
+			t.Errorf("attempt %d published %v, want the first observation after the cursor", i, a.datetime)
+		}
+	}
+	if wait := second.at.Sub(first.at); wait < minRetryDelay {
+		t.Errorf("retried after %v, want at least %v", wait, minRetryDelay)
+	}
+	if wait := third.at.Sub(second.at); wait < 2*minRetryDelay {
+		t.Errorf("retried again after %v, want at least %v", wait, 2*minRetryDelay)
+	}
+	if a := p.next(t); !a.datetime.Equal(t0.Add(40 * time.Minute)) {
+		t.Errorf("then published %v, want the next observation", a.datetime)
+	}
+
+	// Observations already queued are not queued again.
+	d.Enqueue(records(t0.Add(40 * time.Minute)))
+	p.expectNone(t, 50*time.Millisecond)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor := savedCursor(t, path); !cursor.Equal(t0.Add(40 * time.Minute)) {
+		t.Errorf("saved cursor %v, want the last observation published", cursor)
+	}
+}
+
+func TestDispatcherWithoutCursor(t *testing.T) {
+	p := newFakePublisher(0)
+	d, err := NewDispatcher("", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	t0 := time.Date(2014, 7, 1, 12, 0, 0, 0, time.UTC)
+	d.Enqueue(records(t0, t0.Add(20*time.Minute)))
+	if a := p.next(t); !a.datetime.Equal(t0.Add(20 * time.Minute)) {
+		t.Errorf("published %v, want only the newest observation", a.datetime)
+	}
+	p.expectNone(t, 50*time.Millisecond)
+}
+
+func TestDispatcherLive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now().Truncate(time.Second)
+	p := newFakePublisher(0)
+	p.maxAge, p.interval = time.Hour, 100*time.Millisecond
+	d, path := cursorDispatcher(t, dir, now.Add(-3*time.Hour), livePublisher{p})
+
+	// After downtime only the newest observation is sent.
+	d.Enqueue(records(now.Add(-2*time.Hour), now.Add(-90*time.Minute), now.Add(-40*time.Minute), now.Add(-20*time.Minute)))
+	first := p.next(t)
+	if !first.datetime.Equal(now.Add(-20 * time.Minute)) {
+		t.Errorf("published %v, want only the newest observation", first.datetime)
+	}
+	p.expectNone(t, 20*time.Millisecond)
+
+	// Uploads are spaced by the interval, sending the newest observation queued meanwhile.
+	d.Enqueue(records(now.Add(-10 * time.Minute)))
+	d.Enqueue(records(now))
+	second := p.next(t)
+	if !second.datetime.Equal(now) {
+		t.Errorf("published %v, want the newest observation", second.datetime)
+	}
+	if wait := second.at.Sub(first.at); wait < p.interval {
+		t.Errorf("published again after %v, want at least %v", wait, p.interval)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Observations older than maxAge are skipped, and the cursor moves past them.
+	p = newFakePublisher(0)
+	p.maxAge = time.Hour
+	d, path = cursorDispatcher(t, dir, now.Add(-3*time.Hour), livePublisher{p})
+	d.Enqueue(records(now.Add(-2 * time.Hour)))
+	p.expectNone(t, 50*time.Millisecond)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor := savedCursor(t, path); !cursor.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("saved cursor %v, want the skipped observation", cursor)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package publish
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WundergroundURL is the Weather Underground personal weather station upload endpoint.
+const WundergroundURL = "https://weatherstation.wunderground.com/weatherstation/updateweatherstation.php"
+
+// Wunderground uploads observations with the Weather Underground PWS upload protocol, a GET request carrying the
+// observation in imperial units as query parameters. URL defaults to WundergroundURL.
+type Wunderground struct {
+	URL       string
+	StationID string
+	Password  string
+	Client    *http.Client
+}
+
+func (p *Wunderground) Name() string {
+	return "wunderground"
+}
+
+func (p *Wunderground) Publish(obs *Observation) error {
+	endpoint := p.URL
+	if endpoint == "" {
+		endpoint = WundergroundURL
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Get(endpoint + "?" + wundergroundQuery(p.StationID, p.Password, obs).Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(strings.TrimSpace(string(body)), "success") {
+		return errors.New("publish: wunderground rejected upload: " + resp.Status + " " + strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// wundergroundQuery returns the upload parameters for obs. Pressure is reported at sea level as the protocol asks.
+func wundergroundQuery(id, password string, obs *Observation) url.Values {
+	return url.Values{
+		"action":       {"updateraw"},
+		"ID":           {id},
+		"PASSWORD":     {password},
+		"dateutc":      {obs.Datetime.UTC().Format("2006-01-02 15:04:05")},
+		"tempf":        {formatFloat(fahrenheit(obs.Temperature), 1)},
+		"dewptf":       {formatFloat(fahrenheit(obs.DewPoint), 1)},
+		"humidity":     {formatFloat(obs.RelativeHumidity, 0)},
+		"baromin":      {formatFloat(obs.SeaLevelPressure*0.02953, 3)},
+		"rainin":       {formatFloat(obs.RainLastHour/25.4, 2)},
+		"dailyrainin":  {formatFloat(obs.RainToday/25.4, 2)},
+		"softwaretype": {"chapelco-weather"},
+	}
+}
+
+func fahrenheit(celsius float64) float64 {
+	return celsius*9/5 + 32
+}
+
+func formatFloat(x float64, decimals int) string {
+	return strconv.FormatFloat(x, 'f', decimals, 64)
+}
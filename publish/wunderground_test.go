@@ -0,0 +1,64 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package publish
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWundergroundPublish(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		if query.Get("PASSWORD") != "secret" {
+			io.WriteString(w, "INVALIDPASSWORDID|Password or key and/or id are incorrect\n")
+			return
+		}
+		io.WriteString(w, "success\n")
+	}))
+	defer server.Close()
+	p := &Wunderground{URL: server.URL, StationID: "ICHAPELCO1", Password: "secret"}
+	if err := p.Publish(testObservation); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"action":       "updateraw",
+		"ID":           "ICHAPELCO1",
+		"PASSWORD":     "secret",
+		"dateutc":      "2014-07-01 12:15:00",
+		"tempf":        "27.5",
+		"dewptf":       "24.8",
+		"humidity":     "85",
+		"baromin":      "29.920",
+		"rainin":       "0.05",
+		"dailyrainin":  "0.00",
+		"softwaretype": "chapelco-weather",
+	} {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s=%q, want %q", key, got, want)
+		}
+	}
+
+	p.Password = "wrong"
+	err := p.Publish(testObservation)
+	if err == nil || !strings.Contains(err.Error(), "INVALIDPASSWORDID") {
+		t.Errorf("Publish with a wrong password returned %v", err)
+	}
+}
+
+func TestWundergroundPublishServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "success", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	p := &Wunderground{URL: server.URL, StationID: "ICHAPELCO1", Password: "secret"}
+	if err := p.Publish(testObservation); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Publish returned %v, want the status of the failed request", err)
+	}
+}
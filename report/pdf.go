@@ -0,0 +1,140 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Page layout of PDF reports in points, on A4 paper.
+const (
+	pdfWidth      = 595
+	pdfHeight     = 842
+	pdfMargin     = 56
+	pdfFontSize   = 10
+	pdfTitleSize  = 14
+	pdfLeading    = 14
+	pdfLineLength = 90
+)
+
+// winAnsi maps the characters outside Latin-1 that WinAnsiEncoding, the encoding of the standard PDF fonts, has.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96,
+	'—': 0x97,
+}
+
+// writePDF writes lines as a PDF document in Helvetica, the first line as a bold title, wrapping long lines and
+// breaking pages as needed. The standard fonts need no embedding, which keeps the writer small.
+func writePDF(w io.Writer, lines []string) error {
+	var wrapped []string
+	for i, line := range lines {
+		if i == 0 {
+			wrapped = append(wrapped, line)
+			continue
+		}
+		wrapped = append(wrapped, wrapLine(line, pdfLineLength)...)
+	}
+	perPage := (pdfHeight - 2*pdfMargin - pdfTitleSize) / pdfLeading
+	var pages [][]string
+	for len(wrapped) > perPage {
+		pages = append(pages, wrapped[:perPage])
+		wrapped = wrapped[perPage:]
+	}
+	pages = append(pages, wrapped)
+
+	// Objects 1 and 2 are the catalog and page tree, 3 and 4 the fonts, then each page is followed by its contents.
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content bytes.Buffer
+		y := pdfHeight - pdfMargin - pdfTitleSize
+		for j, line := range page {
+			font, size := "F1", pdfFontSize
+			if i == 0 && j == 0 {
+				font, size = "F2", pdfTitleSize
+			}
+			fmt.Fprintf(&content, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, pdfMargin, y, pdfString(line))
+			y -= pdfLeading
+			if i == 0 && j == 0 {
+				y -= pdfTitleSize - pdfFontSize
+			}
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+				"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfWidth, pdfHeight, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	bw := bufio.NewWriter(w)
+	offset, _ := bw.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = offset
+		n, _ := fmt.Fprintf(bw, "%d 0 obj\n%s\nendobj\n", i+1, object)
+		offset += n
+	}
+	fmt.Fprintf(bw, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(bw, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(bw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, offset)
+	return bw.Flush()
+}
+
+// wrapLine breaks line at spaces into lines of at most width characters, keeping its indentation.
+func wrapLine(line string, width int) []string {
+	indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	current := indent + words[0]
+	for _, word := range words[1:] {
+		if len([]rune(current))+1+len([]rune(word)) > width {
+			lines = append(lines, current)
+			current = indent + word
+			continue
+		}
+		current += " " + word
+	}
+	return append(lines, current)
+}
+
+// pdfString encodes s as the body of a PDF literal string in WinAnsiEncoding, replacing characters it lacks with ?.
+func pdfString(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			buf.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&buf, "\\%03o", r)
+		case winAnsi[r] != 0:
+			fmt.Fprintf(&buf, "\\%03o", winAnsi[r])
+		case r == '\t':
+			buf.WriteString("    ")
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	return buf.String()
+}
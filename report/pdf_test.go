@@ -0,0 +1,128 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPDFString(t *testing.T) {
+	for _, test := range []struct {
+		s, want string
+	}{
+		{"Chapelco 1700M", "Chapelco 1700M"},
+		{"(max)", `\(max\)`},
+		{`C:\reports`, `C:\\reports`},
+		{"Presión", `Presi\363n`},
+		{"-2,5 °C", `-2,5 \260C`},
+		{"€ 10 – 20", `\200 10 \226 20`},
+		{"a\tb", "a    b"},
+		{"↑ ⚠ \n", "? ? ?"},
+	} {
+		if got := pdfString(test.s); got != test.want {
+			t.Errorf("pdfString(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
+
+func TestWrapLine(t *testing.T) {
+	for _, test := range []struct {
+		line  string
+		width int
+		want  []string
+	}{
+		{"", 10, []string{""}},
+		{"   ", 10, []string{""}},
+		{"short line", 10, []string{"short line"}},
+		{"one two three four", 9, []string{"one two", "three", "four"}},
+		{"  indented words here", 10, []string{"  indented", "  words", "  here"}},
+		{"unbreakablewordislong ok", 10, []string{"unbreakablewordislong", "ok"}},
+		{"mínima máxima", 6, []string{"mínima", "máxima"}},
+		{"multiple   spaces  between", 30, []string{"multiple spaces between"}},
+	} {
+		if got := wrapLine(test.line, test.width); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrapLine(%q, %d) = %q, want %q", test.line, test.width, got, test.want)
+		}
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	lines := []string{"Daily report (Chapelco)"}
+	for i := 0; i < 120; i++ {
+		lines = append(lines, fmt.Sprintf("Line %d: mínima -2,5 °C", i))
+	}
+	var buf bytes.Buffer
+	if err := writePDF(&buf, lines); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF document")
+	}
+
+	// startxref points at the cross reference table, whose entries point at each object in turn.
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d does not point at the cross reference table", xref)
+	}
+	table := strings.Split(string(pdf[xref:]), "\n")
+	var size int
+	fmt.Sscanf(table[1], "0 %d", &size)
+	// The catalog, page tree and two fonts, then a page and its contents for each of 3 pages of 51 lines.
+	if size != 1+4+2*3 {
+		t.Fatalf("cross reference table of %d entries, want %d", size, 1+4+2*3)
+	}
+	if table[2] != "0000000000 65535 f " {
+		t.Errorf("first entry %q, want the head of the free list", table[2])
+	}
+	for i := 1; i < size; i++ {
+		entry := table[2+i]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Errorf("entry %d is %q", i, entry)
+			continue
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("entry %d points at %q, want object %d", i, pdf[offset:offset+10], i)
+		}
+	}
+	if !bytes.Contains(pdf, []byte(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>", size))) {
+		t.Error("trailer does not give the size of the cross reference table")
+	}
+	if !bytes.Contains(pdf, []byte("/Kids [5 0 R 7 0 R 9 0 R] /Count 3")) {
+		t.Error("page tree does not list 3 pages")
+	}
+
+	// Each stream is as long as its /Length says, and the pages hold every line once.
+	streams := regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)endstream`).FindAllSubmatch(pdf, -1)
+	if len(streams) != 3 {
+		t.Fatalf("%d content streams, want 3", len(streams))
+	}
+	shown := 0
+	for i, s := range streams {
+		if length, _ := strconv.Atoi(string(s[1])); length != len(s[2]) {
+			t.Errorf("stream %d has /Length %d but %d bytes", i, length, len(s[2]))
+		}
+		shown += bytes.Count(s[2], []byte(") Tj ET\n"))
+	}
+	if shown != len(lines) {
+		t.Errorf("%d lines shown, want %d", shown, len(lines))
+	}
+	if !bytes.Contains(pdf, []byte(`/F2 14 Tf 56 772 Td (Daily report \(Chapelco\)) Tj`)) {
+		t.Error("title is not shown in bold at the top of the first page")
+	}
+	if !bytes.Contains(pdf, []byte(`(Line 119: m\355nima -2,5 \260C) Tj`)) {
+		t.Error("last line is not encoded in WinAnsiEncoding")
+	}
+}
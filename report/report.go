@@ -0,0 +1,214 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+// Package report composes the daily conditions report from the station's observations and renders it as text, HTML
+// or PDF. The wording and layout live in templates read from TemplatesDir each time a report is rendered, so they can
+// be edited without rebuilding or restarting the server; the templates translate their labels through i18n.
+package report
+
+import (
+	"bytes"
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// TemplatesDir holds daily.txt, the text/template of the text and PDF reports, and daily.html, the html/template of
+// the HTML report.
+var TemplatesDir = filepath.Join("templates", "reports")
+
+// Formats maps the formats reports can be rendered in to their content types.
+var Formats = map[string]string{
+	"text": "text/plain; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+	"pdf":  "application/pdf",
+}
+
+// ErrNoData is returned for days without observations.
+var ErrNoData = errors.New("report: no observations on the requested day")
+
+// Thresholds of the hazards reported.
+const (
+	hardFreeze      = -10.0 // °C overnight low
+	frost           = 0.0   // °C overnight low
+	heavySnow       = 20.0  // cm of new snow
+	heavyRain       = 25.0  // mm of liquid precipitation
+	fallingPressure = -3.0  // hPa over 3 hours
+	icingHumidity   = 95.0  // % relative humidity near freezing
+	steadyPressure  = 1.0   // hPa over 3 hours
+	rapidPressure   = 3.0   // hPa over 3 hours
+)
+
+// Daily is the conditions report of one local day and the night that follows it, written in Locale. The night runs
+// from sunset until an hour after the next sunrise, by when the overnight low has usually passed, or until the latest
+// observation if that is earlier. NewSnow covers the 24 hours up to the end of the night and Pressure is the latest
+// observation of the night with its 3 hour pressure tendency. Chart, when set, is the URL of a chart of the day shown
+// in the HTML report.
+type Daily struct {
+	Locale      *i18n.Locale
+	Date        time.Time
+	GeneratedAt time.Time
+	Summary     weather.DailySummary
+	Overnight   Overnight
+	NewSnow     weather.SnowEstimate
+	Pressure    *weather.CodedObservation
+	Hazards     []Hazard
+	Chart       htmltemplate.URL
+}
+
+// Overnight summarizes the night after the reported day. Low is only meaningful when there are readings, HasLow.
+type Overnight struct {
+	From          time.Time
+	To            time.Time
+	Low           float64
+	HasLow        bool
+	Precipitation float64
+}
+
+// Hazard is a condition worth warning about. Code identifies the kind of hazard, such as "frost" or "heavy_snow",
+// and Text describes it in the report's language.
+type Hazard struct {
+	Code string
+	Text string
+}
+
+// NewDaily composes the report of the local day containing day in loc.
+func NewDaily(day time.Time, loc *i18n.Locale) (*Daily, error) {
+	summary := weather.ReadDailySummary(day)
+	if summary == nil {
+		return nil, ErrNoData
+	}
+	midnight := weather.LocalMidnight(day)
+	next := weather.SunTimesOn(midnight.AddDate(0, 0, 1))
+	for _, t := range []*time.Time{&summary.Sun.CivilDawn, &summary.Sun.Sunrise, &summary.Sun.SolarNoon,
+		&summary.Sun.Sunset, &summary.Sun.CivilDusk} {
+		*t = t.In(weather.StationTimezone)
+	}
+	d := &Daily{
+		Locale:      loc,
+		Date:        midnight,
+		GeneratedAt: time.Now().In(weather.StationTimezone),
+		Summary:     *summary,
+		Overnight: Overnight{
+			From: summary.Sun.Sunset,
+			To:   next.Sunrise.Add(time.Hour).In(weather.StationTimezone),
+		},
+	}
+	if current := weather.ReadCurrentWeatherRecord(false); current != nil && current.Datetime.Before(d.Overnight.To) {
+		d.Overnight.To = current.Datetime.In(weather.StationTimezone)
+	}
+	if d.Overnight.To.After(d.Overnight.From) {
+		d.Overnight.Low, _, d.Overnight.HasLow = weather.ReadTemperatureRange(d.Overnight.From, d.Overnight.To)
+		d.Overnight.Precipitation = weather.ReadRainBetween(d.Overnight.From, d.Overnight.To)
+	}
+	end := d.Overnight.To
+	if end.Before(midnight.AddDate(0, 0, 1)) {
+		end = midnight.AddDate(0, 0, 1)
+	}
+	d.NewSnow = weather.EstimateNewSnow(end.Add(-24*time.Hour), end)
+	d.Pressure = weather.ReadCodedObservationAt(end)
+	d.Hazards = d.hazards(weather.Anomalies("", midnight))
+	return d, nil
+}
+
+// hazards lists the hazards of d given the anomalies found since the start of the day.
+func (d *Daily) hazards(anomalies []weather.Anomaly) []Hazard {
+	var hazards []Hazard
+	add := func(code string, args ...interface{}) {
+		hazards = append(hazards, Hazard{code, d.T("hazard."+code, args...)})
+	}
+	low := math.Min(d.Summary.MinTemperature, d.Overnight.Low)
+	if !d.Overnight.HasLow {
+		low = d.Summary.MinTemperature
+	}
+	switch {
+	case low <= hardFreeze:
+		add("hard_freeze", d.Locale.Number(low, 1))
+	case low <= frost:
+		add("frost", d.Locale.Number(low, 1))
+	}
+	if d.NewSnow.Depth >= heavySnow {
+		add("heavy_snow", d.Locale.Number(d.NewSnow.Depth, 0))
+	}
+	if rain := d.NewSnow.Precipitation - d.NewSnow.SnowWater; rain >= heavyRain {
+		add("heavy_rain", d.Locale.Number(rain, 1))
+	}
+	if p := d.Pressure; p != nil {
+		if p.PressureTendency <= fallingPressure {
+			add("falling_pressure", d.Locale.Number(-p.PressureTendency, 1))
+		}
+		if t := p.Record.Temperature; t >= -3 && t <= 1 && p.Record.RelativeHumidity >= icingHumidity {
+			add("icing")
+		}
+	}
+	seen := make(map[string]bool)
+	for _, a := range anomalies {
+		if a.Datetime.After(d.Overnight.To) || seen[a.Channel] {
+			continue
+		}
+		seen[a.Channel] = true
+		add("sensor", d.T("channel."+a.Channel))
+	}
+	return hazards
+}
+
+// T returns the message key of the report's locale formatted with args, for templates.
+func (d *Daily) T(key string, args ...interface{}) string {
+	return d.Locale.T(key, args...)
+}
+
+// PressureTrend describes the pressure tendency of the report, or returns an empty string if it is unknown.
+func (d *Daily) PressureTrend() string {
+	if d.Pressure == nil {
+		return ""
+	}
+	change := d.Pressure.PressureTendency
+	switch {
+	case change >= rapidPressure:
+		return d.T("report.pressure_rising_rapidly")
+	case change >= steadyPressure:
+		return d.T("report.pressure_rising")
+	case change <= -rapidPressure:
+		return d.T("report.pressure_falling_rapidly")
+	case change <= -steadyPressure:
+		return d.T("report.pressure_falling")
+	}
+	return d.T("report.pressure_steady")
+}
+
+// Render writes d to w in format, one of Formats.
+func (d *Daily) Render(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		return d.renderText(w)
+	case "html":
+		t, err := htmltemplate.ParseFiles(filepath.Join(TemplatesDir, "daily.html"))
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, d)
+	case "pdf":
+		var buf bytes.Buffer
+		if err := d.renderText(&buf); err != nil {
+			return err
+		}
+		return writePDF(w, strings.Split(strings.TrimRight(buf.String(), "\n"), "\n"))
+	}
+	return errors.New("report: unknown format \"" + format + "\"")
+}
+
+func (d *Daily) renderText(w io.Writer) error {
+	t, err := template.ParseFiles(filepath.Join(TemplatesDir, "daily.txt"))
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, d)
+}
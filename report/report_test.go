@@ -0,0 +1,131 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package report
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// testDaily returns a report of a mild day without hazards, with the night ending at dawn.
+func testDaily() *Daily {
+	return &Daily{
+		Locale:    i18n.English,
+		Summary:   weather.DailySummary{MinTemperature: 2},
+		Overnight: Overnight{To: time.Date(2014, 7, 2, 9, 0, 0, 0, time.UTC), Low: 1, HasLow: true},
+		Pressure: &weather.CodedObservation{Record: weather.WeatherRecord{Temperature: 5, RelativeHumidity: 60},
+			PressureTendency: -1},
+	}
+}
+
+// hazardCodes returns the codes of hazards.
+func hazardCodes(hazards []Hazard) []string {
+	var codes []string
+	for _, h := range hazards {
+		codes = append(codes, h.Code)
+	}
+	return codes
+}
+
+func TestHazards(t *testing.T) {
+	dawn := testDaily().Overnight.To
+	for _, test := range []struct {
+		name      string
+		change    func(*Daily)
+		anomalies []weather.Anomaly
+		want      []string
+	}{
+		{"none", func(d *Daily) {}, nil, nil},
+		{"frost at 0 °C", func(d *Daily) { d.Overnight.Low = 0 }, nil, []string{"frost"}},
+		{"frost during the day", func(d *Daily) { d.Summary.MinTemperature = -9.9 }, nil, []string{"frost"}},
+		{"hard freeze at -10 °C", func(d *Daily) { d.Overnight.Low = -10 }, nil, []string{"hard_freeze"}},
+		{"no overnight readings", func(d *Daily) { d.Overnight.Low, d.Overnight.HasLow = -20, false }, nil, nil},
+		{"heavy snow", func(d *Daily) { d.NewSnow = weather.SnowEstimate{Depth: 20} }, nil, []string{"heavy_snow"}},
+		{"light snow", func(d *Daily) { d.NewSnow = weather.SnowEstimate{Depth: 19.9} }, nil, nil},
+		{"heavy rain", func(d *Daily) {
+			d.NewSnow = weather.SnowEstimate{Precipitation: 30, SnowWater: 5}
+		}, nil, []string{"heavy_rain"}},
+		{"mostly snow", func(d *Daily) {
+			d.NewSnow = weather.SnowEstimate{Precipitation: 30, SnowWater: 5.1, Depth: 5}
+		}, nil, nil},
+		{"falling pressure", func(d *Daily) { d.Pressure.PressureTendency = -3 }, nil, []string{"falling_pressure"}},
+		{"slowly falling pressure", func(d *Daily) { d.Pressure.PressureTendency = -2.9 }, nil, nil},
+		{"rising pressure", func(d *Daily) { d.Pressure.PressureTendency = 5 }, nil, nil},
+		{"no pressure", func(d *Daily) { d.Pressure = nil }, nil, nil},
+		{"icing", func(d *Daily) {
+			d.Pressure.Record.Temperature, d.Pressure.Record.RelativeHumidity = -1, 97
+		}, nil, []string{"icing"}},
+		{"cold and saturated", func(d *Daily) {
+			d.Pressure.Record.Temperature, d.Pressure.Record.RelativeHumidity = -3.1, 97
+		}, nil, nil},
+		{"sensor", func(d *Daily) {}, []weather.Anomaly{
+			{Datetime: dawn.Add(-5 * time.Hour), Channel: "CHN1_DEG"},
+			{Datetime: dawn.Add(-4 * time.Hour), Channel: "PRES_ABS"},
+			{Datetime: dawn.Add(-3 * time.Hour), Channel: "CHN1_DEG"},
+			{Datetime: dawn.Add(time.Hour), Channel: "CHN1_RF"},
+		}, []string{"sensor", "sensor"}},
+		{"everything", func(d *Daily) {
+			d.Overnight.Low = -12
+			d.NewSnow = weather.SnowEstimate{Precipitation: 50, SnowWater: 10, Depth: 25}
+			d.Pressure.PressureTendency = -4
+			d.Pressure.Record.Temperature, d.Pressure.Record.RelativeHumidity = 0, 100
+		}, []weather.Anomaly{{Datetime: dawn, Channel: "CHN1_DEG"}},
+			[]string{"hard_freeze", "heavy_snow", "heavy_rain", "falling_pressure", "icing", "sensor"}},
+	} {
+		d := testDaily()
+		test.change(d)
+		if got := hazardCodes(d.hazards(test.anomalies)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: hazards %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestHazardText(t *testing.T) {
+	d := testDaily()
+	d.Locale = i18n.Spanish
+	d.Overnight.Low = -12.3
+	hazards := d.hazards([]weather.Anomaly{{Datetime: d.Overnight.To, Channel: "CHN1_DEG"}})
+	if len(hazards) != 2 {
+		t.Fatalf("hazards %v, want a hard freeze and a sensor", hazardCodes(hazards))
+	}
+	if want := i18n.Spanish.T("hazard.hard_freeze", "-12,3"); hazards[0].Text != want {
+		t.Errorf("hard freeze described as %q, want %q", hazards[0].Text, want)
+	}
+	if want := i18n.Spanish.T("hazard.sensor", i18n.Spanish.T("channel.CHN1_DEG")); hazards[1].Text != want {
+		t.Errorf("sensor described as %q, want %q", hazards[1].Text, want)
+	}
+}
+
+func TestPressureTrend(t *testing.T) {
+	for _, test := range []struct {
+		change float64
+		want   string
+	}{
+		{5, "report.pressure_rising_rapidly"},
+		{3, "report.pressure_rising_rapidly"},
+		{2.99, "report.pressure_rising"},
+		{1, "report.pressure_rising"},
+		{0.99, "report.pressure_steady"},
+		{0, "report.pressure_steady"},
+		{-0.99, "report.pressure_steady"},
+		{-1, "report.pressure_falling"},
+		{-2.99, "report.pressure_falling"},
+		{-3, "report.pressure_falling_rapidly"},
+	} {
+		d := testDaily()
+		d.Pressure.PressureTendency = test.change
+		if got, want := d.PressureTrend(), i18n.English.T(test.want); got != want {
+			t.Errorf("%v hPa: %q, want %q", test.change, got, want)
+		}
+	}
+	d := testDaily()
+	d.Pressure = nil
+	if got := d.PressureTrend(); got != "" {
+		t.Errorf("unknown tendency described as %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package report
+
+import (
+	"errors"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// ParseClock parses a local time of day such as "07:30" into hours and minutes.
+func ParseClock(s string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, errors.New("report: time of day must be like 07:30, not \"" + s + "\"")
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// ScheduleDaily calls f every day at hour:minute in the station's timezone with the local midnight of the day
+// before, the day the morning's report is about. Calling the returned function stops the schedule, waiting for a call
+// of f in progress to return.
+func ScheduleDaily(hour, minute int, f func(day time.Time)) (stop func()) {
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			now := time.Now().In(weather.StationTimezone)
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, weather.StationTimezone)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			timer := time.NewTimer(next.Sub(now))
+			select {
+			case <-timer.C:
+				f(weather.LocalMidnight(next).AddDate(0, 0, -1))
+			case <-done:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/report"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+
+	"github.com/gorilla/mux"
+)
+
+// reportExtensions are the file extensions of saved reports in each format.
+var reportExtensions = map[string]string{"text": "txt", "html": "html", "pdf": "pdf"}
+
+// reportHandler renders the daily report of the date route variable, a date in the station's timezone, "today" or
+// "yesterday", in the format parameter, html by default.
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	loc := localeRequested(r)
+	day, err := reportDate(mux.Vars(r)["date"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.FormValue("format")
+	if format == "" {
+		format = "html"
+	}
+	contentType, ok := report.Formats[format]
+	if !ok {
+		http.Error(w, loc.T("error.unknown_report_format", format), http.StatusBadRequest)
+		return
+	}
+	d, err := report.NewDaily(day, loc)
+	if err == report.ErrNoData {
+		http.Error(w, loc.T("error.no_report"), http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	if err == nil {
+		d.Chart = htmltemplate.URL("/api/weather/chart.png?" + url.Values{
+			"field": {"Temperature"},
+			"from":  {d.Date.Format(time.RFC3339)},
+			"to":    {d.Overnight.To.Format(time.RFC3339)},
+			"lang":  {loc.Tag},
+		}.Encode())
+		err = d.Render(&buf, format)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Language", loc.Tag)
+	if format == "pdf" {
+		w.Header().Set("Content-Disposition", "inline; filename="+reportName(day, loc, format))
+	}
+	buf.WriteTo(w)
+}
+
+// reportDate parses the date of a report.
+func reportDate(date string) (time.Time, error) {
+	switch date {
+	case "today":
+		return weather.LocalMidnight(time.Now()), nil
+	case "yesterday":
+		return weather.LocalMidnight(time.Now()).AddDate(0, 0, -1), nil
+	}
+	return time.ParseInLocation("2006-01-02", date, weather.StationTimezone)
+}
+
+// reportName returns the file name of the report of day in loc and format.
+func reportName(day time.Time, loc *i18n.Locale, format string) string {
+	return "chapelco-" + day.Format("2006-01-02") + "." + loc.Tag + "." + reportExtensions[format]
+}
+
+// reportFormatNames returns the names of report.Formats.
+func reportFormatNames() []string {
+	names := make([]string, 0, len(report.Formats))
+	for name := range report.Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// startReports runs the daily reports every morning at ReportTime: the report of the previous day is written in every
+// locale and format to the directory ReportsDir, if it is set, and emailed to subscribers, if startNotifier configured
+// email. It returns the function stopping the schedule, or nil if there is none.
+func startReports() (stop func()) {
+	dir := cfg.ReportsDir
+	if dir == "" && notifier == nil {
+		return nil
+	}
+	hour, minute, err := report.ParseClock(cfg.ReportTime)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return report.ScheduleDaily(hour, minute, func(day time.Time) {
+		if dir != "" {
+			if err := saveReports(dir, day); err != nil {
+				log.Println("report:", err)
+			}
+		}
+		if notifier != nil {
+			notifier.SendReport(day)
+		}
+	})
+}
+
+// saveReports writes the report of day in every locale and format to dir.
+func saveReports(dir string, day time.Time) error {
+	for _, loc := range i18n.Locales {
+		d, err := report.NewDaily(day, loc)
+		if err != nil {
+			return err
+		}
+		for format := range report.Formats {
+			var buf bytes.Buffer
+			if err := d.Render(&buf, format); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, reportName(day, loc, format)), buf.Bytes(), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
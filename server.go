@@ -0,0 +1,95 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// ready is 1 while the server can answer with data: after the first load of the weather table and before shutdown.
+var ready int32
+
+// flushTimeout is how long the work done in the background has to stop and save its state once requests are drained:
+// with the default ShutdownTimeout, what is left of the 30 seconds Heroku allows after SIGTERM.
+const flushTimeout = 10 * time.Second
+
+// shuttingDown is closed when the server starts shutting down, so that streams that would otherwise never end return
+// and let in-flight requests drain.
+var shuttingDown = make(chan struct{})
+
+// serve answers requests with handler until the process receives SIGTERM or an interrupt, then stops accepting
+// connections, ends streams and waits up to ShutdownTimeout for in-flight requests to finish. It returns once the
+// server has stopped.
+func serve(handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadTimeout.Duration,
+		ReadTimeout:       cfg.ReadTimeout.Duration,
+		WriteTimeout:      cfg.WriteTimeout.Duration,
+		IdleTimeout:       cfg.IdleTimeout.Duration,
+	}
+	srv.RegisterOnShutdown(func() {
+		close(shuttingDown)
+		hub.closeAll()
+	})
+	go func() {
+		<-weather.Loaded()
+		if atomic.CompareAndSwapInt32(&ready, 0, 1) {
+			log.Println("ready: weather data loaded")
+		}
+	}()
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- srv.ListenAndServe()
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-signals:
+		log.Println("shutdown:", sig)
+	}
+	atomic.StoreInt32(&ready, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		// Requests still running are cut off rather than holding up the flush of background work.
+		log.Println("shutdown:", err)
+		srv.Close()
+	}
+	return nil
+}
+
+// healthHandler reports that the process is up, whether or not it has data yet.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, "ok\n")
+}
+
+// readyHandler reports whether the server should be sent traffic: 200 once the weather data is loaded, 503 before
+// then and while shutting down.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if atomic.LoadInt32(&ready) != 1 {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
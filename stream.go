@@ -0,0 +1,102 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+)
+
+// Stream tuning: how often idle connections get a heartbeat comment, how many refreshes a client may fall behind
+// before it is dropped, how long browsers wait before reconnecting and how long a write may take.
+const (
+	streamHeartbeat = 15 * time.Second
+	streamBuffer    = 4
+	streamRetry     = 10 * time.Second
+	streamWrite     = 10 * time.Second
+)
+
+// streamHandler sends new records as Server-Sent Events named "record", with the record's Datetime as the event id.
+// Clients resuming with a Last-Event-ID header, or a lastEventId parameter, first get the records they missed; new
+// clients first get the current record. Clients that fall behind are disconnected and catch up when they resume, as
+// are all clients when the server shuts down. Streams outlive the server's timeouts, so each write gets a deadline of
+// its own instead.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// Subscribe before reading what was missed so that no refresh falls in between.
+	records, unsubscribe := weather.Subscribe(streamBuffer)
+	defer unsubscribe()
+	var backlog []weather.WeatherRecord
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	if lastID != "" {
+		since, err := time.Parse(time.RFC3339, lastID)
+		if err != nil {
+			http.Error(w, localeRequested(r).T("error.invalid_last_event_id", err), http.StatusBadRequest)
+			return
+		}
+		backlog = weather.ReadWeatherRecordsAfter(since)
+	} else if current := weather.ReadCurrentWeatherRecord(false); current != nil {
+		backlog = []weather.WeatherRecord{*current}
+	}
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Now().Add(streamWrite))
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry/time.Millisecond)
+	var last time.Time
+	send := func(batch []weather.WeatherRecord) error {
+		controller.SetWriteDeadline(time.Now().Add(streamWrite))
+		for _, record := range batch {
+			if !record.Datetime.After(last) {
+				continue
+			}
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: record\nid: %s\ndata: %s\n\n", record.Datetime.Format(time.RFC3339), data); err != nil {
+				return err
+			}
+			last = record.Datetime
+		}
+		flusher.Flush()
+		return nil
+	}
+	if send(backlog) != nil {
+		return
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case batch, ok := <-records:
+			if !ok || send(batch) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			controller.SetWriteDeadline(time.Now().Add(streamWrite))
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-shuttingDown:
+			return
+		}
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/i18n"
+	"github.com/EntilZha/chapelco-weather-goajs/weather"
+	"github.com/EntilZha/chapelco-weather-goajs/websocket"
+)
+
+// Subscription tuning: how many messages a client may fall behind before it is dropped, how often idle clients are
+// pinged, how long a write may take and how long a client may stay silent, pongs included.
+const (
+	subscriptionBuffer = 16
+	subscriptionPing   = 30 * time.Second
+	subscriptionWrite  = 10 * time.Second
+	subscriptionIdle   = 2 * subscriptionPing
+)
+
+// subscribeRequest is the message clients send to choose what they receive, such as
+// {"Channels": ["Temperature"], "Aggregation": "hourly"}. Channels are field names or columns, all fields when empty;
+// Aggregation is one of weather.Aggregations, raw by default. The snapshot starts at Since, by default a day ago or a
+// week ago for the daily aggregation. A new request replaces the previous one.
+type subscribeRequest struct {
+	Channels    []string
+	Aggregation string
+	Since       time.Time
+}
+
+// subscriptionMessage is sent to clients: first a "snapshot" of the aggregates since the requested time, then an
+// "update" with the aggregates changed by each refresh, or an "error" when a request is invalid.
+type subscriptionMessage struct {
+	Type        string
+	Aggregation string              `json:",omitempty"`
+	Aggregates  []weather.Aggregate `json:",omitempty"`
+	Error       string              `json:",omitempty"`
+}
+
+// subscription is what a client currently receives.
+type subscription struct {
+	fields      []weather.Field
+	aggregation string
+}
+
+// key identifies the messages shared by every client with the same subscription.
+func (s subscription) key() string {
+	names := make([]string, len(s.fields))
+	for i, f := range s.fields {
+		names[i] = f.Name
+	}
+	return s.aggregation + ":" + strings.Join(names, ",")
+}
+
+// subscriber is one WebSocket connection. Messages for it are queued in send and written by its own goroutine, so a
+// slow connection never holds up the others.
+type subscriber struct {
+	conn *websocket.Conn
+	send chan []byte
+	sub  *subscription
+}
+
+// subscriptionHub fans the records of each refresh out to every subscriber, computing each aggregation and encoding
+// each distinct subscription once per refresh.
+type subscriptionHub struct {
+	sync.Mutex
+	subscribers map[*subscriber]bool
+	once        sync.Once
+}
+
+var hub = &subscriptionHub{subscribers: make(map[*subscriber]bool)}
+
+// subscriptionsHandler upgrades the request to a WebSocket connection serving subscribeRequests. Only pages served by
+// the server itself or from the WebSocketOrigins may open one.
+func subscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r, cfg.Origins())
+	if err != nil {
+		return
+	}
+	conn.SetReadTimeout(subscriptionIdle)
+	hub.once.Do(func() { go hub.run() })
+	loc := localeRequested(r)
+	s := &subscriber{conn: conn, send: make(chan []byte, subscriptionBuffer)}
+	hub.Lock()
+	hub.subscribers[s] = true
+	hub.Unlock()
+	go s.write()
+	defer hub.remove(s)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var request subscribeRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			hub.deliver(s, errorMessage(err.Error()))
+			continue
+		}
+		sub, err := parseSubscription(request, loc)
+		if err != nil {
+			hub.deliver(s, errorMessage(err.Error()))
+			continue
+		}
+		since := request.Since
+		if since.IsZero() {
+			since = time.Now().Add(-24 * time.Hour)
+			if sub.aggregation == "daily" {
+				since = time.Now().AddDate(0, 0, -7)
+			}
+		}
+		// Subscribe before reading the snapshot so that no refresh falls in between. An update may then repeat part of
+		// the snapshot, which clients handle by replacing aggregates with the same Datetime.
+		hub.Lock()
+		s.sub = sub
+		hub.Unlock()
+		aggregates, err := weather.ReadAggregates(sub.fields, sub.aggregation, since)
+		if err != nil {
+			hub.deliver(s, errorMessage(err.Error()))
+			continue
+		}
+		message, err := json.Marshal(subscriptionMessage{Type: "snapshot", Aggregation: sub.aggregation, Aggregates: aggregates})
+		if err != nil {
+			hub.deliver(s, errorMessage(err.Error()))
+			continue
+		}
+		hub.deliver(s, message)
+	}
+}
+
+// parseSubscription validates request, describing what is wrong with it in loc.
+func parseSubscription(request subscribeRequest, loc *i18n.Locale) (*subscription, error) {
+	fields, err := weather.ParseFields(strings.Join(request.Channels, ","))
+	if err != nil {
+		return nil, err
+	}
+	aggregation := request.Aggregation
+	if aggregation == "" {
+		aggregation = "raw"
+	}
+	if !weather.ValidAggregation(aggregation) {
+		return nil, errors.New(loc.T("error.unknown_aggregation", aggregation))
+	}
+	// Datetime is always part of an Aggregate, so it is not a value.
+	return &subscription{fields: fields[1:], aggregation: aggregation}, nil
+}
+
+// write sends the messages queued for s and pings it while idle, until its queue is closed or a write fails.
+func (s *subscriber) write() {
+	ping := time.NewTicker(subscriptionPing)
+	defer ping.Stop()
+	defer s.conn.Close()
+	for {
+		select {
+		case message, ok := <-s.send:
+			if !ok {
+				return
+			}
+			s.conn.SetWriteDeadline(time.Now().Add(subscriptionWrite))
+			if err := s.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ping.C:
+			s.conn.SetWriteDeadline(time.Now().Add(subscriptionWrite))
+			if err := s.conn.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// run sends the aggregates changed by each refresh to the subscribers.
+func (h *subscriptionHub) run() {
+	for {
+		records, unsubscribe := weather.Subscribe(1)
+		for batch := range records {
+			h.broadcast(batch)
+		}
+		// The hub fell behind a refresh and was dropped. Its updates are lost, but the next refresh brings the
+		// aggregates of the periods it touches up to date.
+		unsubscribe()
+		log.Println("subscriptions: resubscribing after falling behind")
+	}
+}
+
+// broadcast sends the aggregates touched by records to every subscriber.
+func (h *subscriptionHub) broadcast(records []weather.WeatherRecord) {
+	h.Lock()
+	subs := make(map[*subscriber]*subscription, len(h.subscribers))
+	for s := range h.subscribers {
+		if s.sub != nil {
+			subs[s] = s.sub
+		}
+	}
+	h.Unlock()
+	// Aggregates are read once per aggregation with every field, then narrowed to each subscription.
+	aggregates := make(map[string][]weather.Aggregate)
+	messages := make(map[string][]byte)
+	for s, sub := range subs {
+		key := sub.key()
+		message, ok := messages[key]
+		if !ok {
+			all, read := aggregates[sub.aggregation]
+			if !read {
+				var err error
+				all, err = weather.ReadAggregates(weather.Fields[1:], sub.aggregation, records[0].Datetime)
+				if err != nil {
+					log.Println("subscriptions:", err)
+				}
+				aggregates[sub.aggregation] = all
+			}
+			var err error
+			message, err = json.Marshal(subscriptionMessage{Type: "update", Aggregation: sub.aggregation, Aggregates: narrow(all, sub.fields)})
+			if err != nil {
+				log.Println("subscriptions:", err)
+				continue
+			}
+			messages[key] = message
+		}
+		h.deliver(s, message)
+	}
+}
+
+// narrow returns aggregates with only the values of fields.
+func narrow(aggregates []weather.Aggregate, fields []weather.Field) []weather.Aggregate {
+	narrowed := make([]weather.Aggregate, len(aggregates))
+	for i, a := range aggregates {
+		narrowed[i] = weather.Aggregate{Datetime: a.Datetime, Count: a.Count, Values: make(map[string]float64, len(fields))}
+		for _, f := range fields {
+			narrowed[i].Values[f.Name] = a.Values[f.Name]
+		}
+	}
+	return narrowed
+}
+
+// deliver queues message for s, dropping s if its queue is full.
+func (h *subscriptionHub) deliver(s *subscriber, message []byte) {
+	h.Lock()
+	defer h.Unlock()
+	if !h.subscribers[s] {
+		return
+	}
+	select {
+	case s.send <- message:
+	default:
+		delete(h.subscribers, s)
+		close(s.send)
+	}
+}
+
+// remove drops s, which closes its connection once its queue is written out.
+func (h *subscriptionHub) remove(s *subscriber) {
+	h.Lock()
+	defer h.Unlock()
+	if h.subscribers[s] {
+		delete(h.subscribers, s)
+		close(s.send)
+	}
+}
+
+// closeAll disconnects every subscriber, which hijacked connections the server does not track, for shutdown.
+func (h *subscriptionHub) closeAll() {
+	h.Lock()
+	defer h.Unlock()
+	for s := range h.subscribers {
+		delete(h.subscribers, s)
+		close(s.send)
+	}
+}
+
+// errorMessage encodes an "error" subscriptionMessage.
+func errorMessage(text string) []byte {
+	message, _ := json.Marshal(subscriptionMessage{Type: "error", Error: text})
+	return message
+}
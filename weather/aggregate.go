@@ -0,0 +1,97 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Aggregations are the supported aggregation levels: every record as recorded, or hourly and daily periods in the
+// station's timezone.
+var Aggregations = []string{"raw", "hourly", "daily"}
+
+// Aggregate summarizes the records of one period starting at Datetime. Values holds the mean of each field keyed by
+// field name, except for RainSum which holds the rain that fell during the period. For the raw aggregation each
+// Aggregate is a single record.
+type Aggregate struct {
+	Datetime time.Time
+	Count    int
+	Values   map[string]float64
+}
+
+// ValidAggregation reports whether aggregation is one of Aggregations.
+func ValidAggregation(aggregation string) bool {
+	for _, a := range Aggregations {
+		if a == aggregation {
+			return true
+		}
+	}
+	return false
+}
+
+// PeriodStart returns the start of the aggregation period containing t.
+func PeriodStart(aggregation string, t time.Time) time.Time {
+	switch aggregation {
+	case "hourly":
+		return t.Truncate(time.Hour)
+	case "daily":
+		return LocalMidnight(t)
+	}
+	return t
+}
+
+// ReadAggregates reads the records in the cached DbfTable from the start of the period containing from on, and
+// aggregates fields over each period.
+func ReadAggregates(fields []Field, aggregation string, from time.Time) ([]Aggregate, error) {
+	if !ValidAggregation(aggregation) {
+		return nil, errors.New("weather: unknown aggregation \"" + aggregation + "\"")
+	}
+	table, err := getDbf()
+	if err != nil {
+		return nil, err
+	}
+	total := table.NumberOfRecords()
+	first := firstRowFrom(table, total, PeriodStart(aggregation, from))
+	var aggregates []Aggregate
+	var current *Aggregate
+	// The rain of the first period is counted from the record before it.
+	lastRain := -1.0
+	if first > 0 {
+		if rain, err := readChannel(table, first-1, rainSum, false); err == nil {
+			lastRain = rain
+		}
+	}
+	temps := newMeanTemperatures(table, false)
+	for i := first; i < total; i++ {
+		record := readWeatherRecordFromDbf(table, i, false, temps)
+		if record == nil {
+			return nil, errors.New("weather: could not read record " + strconv.Itoa(i))
+		}
+		start := PeriodStart(aggregation, record.Datetime)
+		if current == nil || !start.Equal(current.Datetime) {
+			aggregates = append(aggregates, Aggregate{Datetime: start, Values: make(map[string]float64)})
+			current = &aggregates[len(aggregates)-1]
+		}
+		current.Count++
+		for _, f := range fields {
+			value, ok := f.Value(record).(float64)
+			if !ok {
+				continue
+			}
+			if f.Column == rainSum {
+				rise := 0.0
+				if lastRain >= 0 && value > lastRain {
+					rise = value - lastRain
+				}
+				current.Values[f.Name] += rise
+				continue
+			}
+			current.Values[f.Name] += (value - current.Values[f.Name]) / float64(current.Count)
+		}
+		lastRain = record.RainSum
+	}
+	return aggregates, nil
+}
@@ -0,0 +1,309 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// Constants tuning the robust anomaly detector. Observations arrive roughly every 20 minutes, so anomalyWindow rows
+// cover about one day.
+const (
+	anomalyWindow    = 72
+	seasonalDays     = 7
+	seasonalSlack    = 30 * time.Minute
+	anomalyThreshold = 3.5
+	maxAnomalies     = 1000
+)
+
+// anomalyChannels are the channels checked for anomalies. RAIN_SUM is a running total so it is left out.
+var anomalyChannels = []string{presLoc, presAbs, chn1Deg, chn1Dew, chn1Rf}
+
+// madFloor is the smallest spread used for each channel, so that a flat lined sensor does not divide by zero and
+// tiny fluctuations on an otherwise steady channel are not scored as anomalies.
+var madFloor = map[string]float64{
+	presLoc: 0.2,
+	presAbs: 0.2,
+	chn1Deg: 0.2,
+	chn1Dew: 0.2,
+	chn1Rf:  1.0,
+}
+
+// diurnalChannels follow the daily cycle closely enough to also be scored against the same time on previous days.
+// Pressure is driven by passing weather systems rather than the time of day, so it only gets the rolling score.
+var diurnalChannels = map[string]bool{chn1Deg: true, chn1Dew: true, chn1Rf: true}
+
+// detectedAnomalies holds the most recent anomalies found, oldest first.
+var detectedAnomalies = new(anomalyLog)
+
+// anomalyHandlers are called for each anomaly found in newly refreshed rows.
+var anomalyHandlers []func(Anomaly)
+
+// Anomaly is a single reading flagged by the detector. RollingScore compares the reading to the median and median
+// absolute deviation of the previous day, SeasonalScore compares it to readings at the same time of day over the
+// previous week and is 0 for channels without a diurnal cycle. Score is the larger of the two in absolute value.
+type Anomaly struct {
+	Datetime      time.Time
+	Channel       string
+	Value         float64
+	Score         float64
+	RollingScore  float64
+	SeasonalScore float64
+}
+
+// anomalyLog is a bounded, lock protected list of anomalies and when anomalies were last added to it.
+type anomalyLog struct {
+	anomalies []Anomaly
+	changedAt time.Time
+	sync.RWMutex
+}
+
+// anomalyKey identifies the reading an anomaly was found in.
+type anomalyKey struct {
+	datetime time.Time
+	channel  string
+}
+
+// pendingDetection is the refresh waiting to be scored by the detector goroutine: its table, the first row to score
+// and the first row whose anomalies are passed to the OnAnomaly handlers, noAlerts for none. Refreshes that arrive
+// while one is waiting are merged into it, so that a slow detector never holds up the request that refreshed the table.
+// scoring is set while the detector scores a refresh it took.
+var pendingDetection struct {
+	table   *godbf.DbfTable
+	first   int
+	alerts  int
+	scoring bool
+	ready   chan struct{}
+	sync.Mutex
+}
+
+// noAlerts is the first row to alert from when no row is, as when the table is loaded on startup.
+const noAlerts = math.MaxInt32
+
+func init() {
+	pendingDetection.ready = make(chan struct{}, 1)
+	OnRefresh(queueDetection)
+	go func() {
+		for range pendingDetection.ready {
+			pendingDetection.Lock()
+			table, first, alerts := pendingDetection.table, pendingDetection.first, pendingDetection.alerts
+			pendingDetection.table, pendingDetection.scoring = nil, table != nil
+			pendingDetection.Unlock()
+			if table != nil {
+				detectAnomalies(table, first, alerts)
+				pendingDetection.Lock()
+				pendingDetection.scoring = false
+				pendingDetection.Unlock()
+			}
+		}
+	}()
+}
+
+// queueDetection hands the rows from first on of table to the detector goroutine, alerting about them unless first is
+// 0, when the whole table is new. If an earlier refresh has not been scored yet, the new table replaces its table and
+// scoring and alerting each start from the earlier of their rows, so that merging a refresh into the first load still
+// alerts about the rows it brought.
+func queueDetection(table *godbf.DbfTable, first int) {
+	alerts := first
+	if first == 0 {
+		alerts = noAlerts
+	}
+	pendingDetection.Lock()
+	if pendingDetection.table != nil {
+		if pendingDetection.first < first {
+			first = pendingDetection.first
+		}
+		if pendingDetection.alerts < alerts {
+			alerts = pendingDetection.alerts
+		}
+	}
+	pendingDetection.table, pendingDetection.first, pendingDetection.alerts = table, first, alerts
+	pendingDetection.Unlock()
+	select {
+	case pendingDetection.ready <- struct{}{}:
+	default:
+	}
+}
+
+// OnAnomaly registers f to be called for every anomaly found in rows brought in by a refresh of the cached table.
+// Anomalies found in the history loaded on startup are recorded but not passed to f.
+func OnAnomaly(f func(Anomaly)) {
+	anomalyHandlers = append(anomalyHandlers, f)
+}
+
+// Anomalies returns the recorded anomalies for channel at or after since, oldest first. An empty channel matches
+// all channels.
+func Anomalies(channel string, since time.Time) []Anomaly {
+	detectedAnomalies.RLock()
+	defer detectedAnomalies.RUnlock()
+	found := make([]Anomaly, 0)
+	for _, a := range detectedAnomalies.anomalies {
+		if (channel == "" || a.Channel == channel) && !a.Datetime.Before(since) {
+			found = append(found, a)
+		}
+	}
+	return found
+}
+
+// anomalyState returns when anomalies were last recorded and whether a refresh is still waiting to be or being scored,
+// so that the anomalies recorded may be about to change.
+func anomalyState() (changedAt time.Time, detecting bool) {
+	pendingDetection.Lock()
+	detecting = pendingDetection.table != nil || pendingDetection.scoring
+	pendingDetection.Unlock()
+	detectedAnomalies.RLock()
+	defer detectedAnomalies.RUnlock()
+	return detectedAnomalies.changedAt, detecting
+}
+
+// detectAnomalies scores the calibrated readings of rows first through the end of table and records those at or
+// above anomalyThreshold, passing those in rows alerts onwards to the OnAnomaly handlers. Readings already recorded,
+// as when a table that shrank or rotated is scored again from the start, are neither recorded nor passed on twice.
+func detectAnomalies(table *godbf.DbfTable, first, alerts int) {
+	total := table.NumberOfRecords()
+	lo := first - (seasonalDays+1)*anomalyWindow
+	if lo < 0 {
+		lo = 0
+	}
+	start := first
+	if start < lo+anomalyWindow {
+		start = lo + anomalyWindow
+	}
+	if start >= total {
+		return
+	}
+	times := make([]time.Time, total-lo)
+	for i := range times {
+		t, err := readDatetime(table, i+lo)
+		if err != nil {
+			return
+		}
+		times[i] = t
+	}
+	var found []Anomaly
+	for _, channel := range anomalyChannels {
+		values := make([]float64, total-lo)
+		for i := range values {
+			v, err := table.Float64FieldValueByName(i+lo, channel)
+			if err != nil {
+				v = math.NaN()
+			}
+			values[i] = calibrate(channel, times[i], v)
+		}
+		for i := start - lo; i < len(values); i++ {
+			if math.IsNaN(values[i]) {
+				continue
+			}
+			rolling := robustScore(values[i], values[i-anomalyWindow:i], madFloor[channel])
+			var seasonal float64
+			if diurnalChannels[channel] {
+				seasonal = robustScore(values[i], seasonalValues(times, values, i), madFloor[channel])
+			}
+			score := math.Max(math.Abs(rolling), math.Abs(seasonal))
+			if score >= anomalyThreshold {
+				found = append(found, Anomaly{times[i], channel, values[i], score, rolling, seasonal})
+			}
+		}
+	}
+	sort.Sort(byDatetime(found))
+	detectedAnomalies.Lock()
+	recorded := make(map[anomalyKey]bool, len(detectedAnomalies.anomalies))
+	for _, a := range detectedAnomalies.anomalies {
+		recorded[anomalyKey{a.Datetime, a.Channel}] = true
+	}
+	fresh := found[:0]
+	for _, a := range found {
+		if !recorded[anomalyKey{a.Datetime, a.Channel}] {
+			fresh = append(fresh, a)
+		}
+	}
+	detectedAnomalies.anomalies = append(detectedAnomalies.anomalies, fresh...)
+	if len(fresh) > 0 {
+		detectedAnomalies.changedAt = time.Now()
+	}
+	// A table scored again from the start can bring back anomalies older than those recorded.
+	sort.Stable(byDatetime(detectedAnomalies.anomalies))
+	if len(detectedAnomalies.anomalies) > maxAnomalies {
+		detectedAnomalies.anomalies = detectedAnomalies.anomalies[len(detectedAnomalies.anomalies)-maxAnomalies:]
+	}
+	detectedAnomalies.Unlock()
+	if alerts < total {
+		for _, a := range fresh {
+			if a.Datetime.Before(times[alerts-lo]) {
+				continue
+			}
+			for _, f := range anomalyHandlers {
+				f(a)
+			}
+		}
+	}
+}
+
+// seasonalValues returns the values recorded closest to the time of day of row i on each of the previous
+// seasonalDays.
+func seasonalValues(times []time.Time, values []float64, i int) []float64 {
+	var seasonal []float64
+	for k := 1; k <= seasonalDays; k++ {
+		target := times[i].Add(-time.Duration(k) * 24 * time.Hour)
+		j := sort.Search(i, func(j int) bool { return !times[j].Before(target) })
+		if j > 0 && (j == i || target.Sub(times[j-1]) < times[j].Sub(target)) {
+			j--
+		}
+		if j < i && absDuration(times[j].Sub(target)) <= seasonalSlack {
+			seasonal = append(seasonal, values[j])
+		}
+	}
+	return seasonal
+}
+
+// absDuration returns the absolute value of d.
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// robustScore returns the modified z-score of x against sample using the median and median absolute deviation. At
+// least three non NaN values are needed, otherwise the score is 0.
+func robustScore(x float64, sample []float64, floor float64) float64 {
+	clean := make([]float64, 0, len(sample))
+	for _, v := range sample {
+		if !math.IsNaN(v) {
+			clean = append(clean, v)
+		}
+	}
+	if len(clean) < 3 {
+		return 0
+	}
+	med := median(clean)
+	deviations := make([]float64, len(clean))
+	for i, v := range clean {
+		deviations[i] = math.Abs(v - med)
+	}
+	mad := math.Max(median(deviations), floor)
+	return (x - med) / (1.4826 * mad)
+}
+
+// median returns the median of values, reordering them in the process.
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// byDatetime sorts anomalies oldest first.
+type byDatetime []Anomaly
+
+func (a byDatetime) Len() int           { return len(a) }
+func (a byDatetime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byDatetime) Less(i, j int) bool { return a[i].Datetime.Before(a[j].Datetime) }
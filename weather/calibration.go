@@ -0,0 +1,200 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// calibrations holds the registered calibration events for each channel, oldest first.
+var calibrations = &calibrationRegistry{byChannel: make(map[string][]Calibration)}
+
+// Calibration is a correction for one channel that applies to readings taken at or after Datetime, until the next
+// calibration registered for the same channel. If Curve is given the raw value is mapped through it by linear
+// interpolation, otherwise the corrected value is raw*Gain + Offset. A zero Gain is taken to mean 1.
+type Calibration struct {
+	Datetime time.Time
+	Channel  string
+	Offset   float64
+	Gain     float64
+	Curve    []CurvePoint
+}
+
+// CurvePoint maps a Raw sensor value to its Corrected value in a calibration lookup curve.
+type CurvePoint struct {
+	Raw       float64
+	Corrected float64
+}
+
+// calibrationsFile serializes SaveCalibration, which reads and rewrites a file.
+var calibrationsFile sync.Mutex
+
+// calibrationRegistry is a lock protected set of calibrations keyed by channel. changedAt is when a calibration was
+// last registered.
+type calibrationRegistry struct {
+	byChannel map[string][]Calibration
+	changedAt time.Time
+	sync.RWMutex
+}
+
+// RegisterCalibration adds c to the calibrations applied to readings. Calibrations may be registered in any order.
+func RegisterCalibration(c Calibration) error {
+	if err := checkCalibration(c); err != nil {
+		return err
+	}
+	if c.Gain == 0 {
+		c.Gain = 1
+	}
+	c.Curve = append([]CurvePoint(nil), c.Curve...)
+	sort.Sort(byRaw(c.Curve))
+	calibrations.Lock()
+	defer calibrations.Unlock()
+	// Build a new slice so readers holding the previous one are unaffected.
+	events := append(append([]Calibration(nil), calibrations.byChannel[c.Channel]...), c)
+	sort.Sort(byCalibrationDatetime(events))
+	calibrations.byChannel[c.Channel] = events
+	calibrations.changedAt = time.Now()
+	return nil
+}
+
+// checkCalibration returns an error if c cannot be registered.
+func checkCalibration(c Calibration) error {
+	switch c.Channel {
+	case rainSum, presLoc, presAbs, chn1Deg, chn1Dew, chn1Rf:
+		return nil
+	}
+	return errors.New("weather: cannot calibrate unknown channel \"" + c.Channel + "\"")
+}
+
+// SaveCalibration adds c to the JSON array stored in the file at path, creating the file if it does not exist, so
+// that a calibration registered while the server runs is loaded again by LoadCalibrations. The file is read again
+// rather than rewritten from the registered calibrations, so that edits made to it since it was loaded are kept.
+func SaveCalibration(path string, c Calibration) error {
+	if err := checkCalibration(c); err != nil {
+		return err
+	}
+	calibrationsFile.Lock()
+	defer calibrationsFile.Unlock()
+	var saved []Calibration
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	data, err = json.MarshalIndent(append(saved, c), "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadCalibrations registers every calibration in the JSON array stored in the file at path.
+func LoadCalibrations(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var loaded []Calibration
+	if err := json.NewDecoder(f).Decode(&loaded); err != nil {
+		return err
+	}
+	for _, c := range loaded {
+		if err := RegisterCalibration(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Calibrations returns all registered calibrations ordered by channel and then by time.
+func Calibrations() []Calibration {
+	calibrations.RLock()
+	defer calibrations.RUnlock()
+	channels := make([]string, 0, len(calibrations.byChannel))
+	for channel := range calibrations.byChannel {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	all := make([]Calibration, 0)
+	for _, channel := range channels {
+		all = append(all, calibrations.byChannel[channel]...)
+	}
+	return all
+}
+
+// CalibrationsChanged returns when a calibration was last registered, or the zero time if none has been.
+func CalibrationsChanged() time.Time {
+	calibrations.RLock()
+	defer calibrations.RUnlock()
+	return calibrations.changedAt
+}
+
+// hasCalibrations reports whether any calibration is registered for channel.
+func hasCalibrations(channel string) bool {
+	calibrations.RLock()
+	defer calibrations.RUnlock()
+	return len(calibrations.byChannel[channel]) > 0
+}
+
+// calibrate returns the corrected value of a channel reading taken at t.
+func calibrate(channel string, t time.Time, value float64) float64 {
+	calibrations.RLock()
+	events := calibrations.byChannel[channel]
+	calibrations.RUnlock()
+	i := sort.Search(len(events), func(i int) bool { return events[i].Datetime.After(t) })
+	if i == 0 {
+		return value
+	}
+	return events[i-1].apply(value)
+}
+
+// apply returns value corrected by c.
+func (c Calibration) apply(value float64) float64 {
+	if len(c.Curve) == 0 {
+		return value*c.Gain + c.Offset
+	}
+	if len(c.Curve) == 1 {
+		return value + c.Curve[0].Corrected - c.Curve[0].Raw
+	}
+	// Extrapolate past either end of the curve using its first or last segment.
+	i := sort.Search(len(c.Curve), func(i int) bool { return c.Curve[i].Raw >= value })
+	if i == 0 {
+		i = 1
+	} else if i == len(c.Curve) {
+		i = len(c.Curve) - 1
+	}
+	lo, hi := c.Curve[i-1], c.Curve[i]
+	if hi.Raw == lo.Raw {
+		return lo.Corrected
+	}
+	return lo.Corrected + (value-lo.Raw)*(hi.Corrected-lo.Corrected)/(hi.Raw-lo.Raw)
+}
+
+// byCalibrationDatetime sorts calibrations oldest first.
+type byCalibrationDatetime []Calibration
+
+func (c byCalibrationDatetime) Len() int           { return len(c) }
+func (c byCalibrationDatetime) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byCalibrationDatetime) Less(i, j int) bool { return c[i].Datetime.Before(c[j].Datetime) }
+
+// byRaw sorts curve points by their raw value.
+type byRaw []CurvePoint
+
+func (p byRaw) Len() int           { return len(p) }
+func (p byRaw) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byRaw) Less(i, j int) bool { return p[i].Raw < p[j].Raw }
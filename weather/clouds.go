@@ -0,0 +1,184 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"math"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// Thresholds for turning the station's temperature curve into a cloud estimate. A clear, calm night at the station
+// cools by around a degree an hour, while under overcast skies the temperature barely moves. A dew point depression
+// of a degree or less means the station is inside the cloud.
+const (
+	clearCoolingRate    = 1.0
+	saturatedDepression = 1.0
+	dryDepression       = 6.0
+)
+
+// Sky classifications of CloudEstimate and NightSky.
+const (
+	skyClear        = "clear"
+	skyPartlyCloudy = "partly cloudy"
+	skyOvercast     = "overcast"
+)
+
+// CloudEstimate is the estimated cloud cover at the time of one observation. ClearSkyRadiation is the theoretical
+// global radiation in W/m² under a cloudless sky, CoolingRate is the temperature drop over the previous hour in °C
+// and CloudCover runs from 0 for a clear sky to 1 for overcast. The station has no pyranometer, so during the day
+// the estimate rests on the dew point depression alone and is rougher than at night.
+type CloudEstimate struct {
+	Datetime           time.Time
+	SolarElevation     float64
+	ClearSkyRadiation  float64
+	CoolingRate        float64
+	DewPointDepression float64
+	CloudCover         float64
+	Sky                string
+}
+
+// NightSky summarizes the cloud estimates between civil dusk and civil dawn of one night. Cooling is the total
+// temperature drop over the night.
+type NightSky struct {
+	Dusk       time.Time
+	Dawn       time.Time
+	Cooling    float64
+	CloudCover float64
+	Sky        string
+}
+
+// ClearSkyRadiation returns the global radiation in W/m² reaching the ground under a cloudless sky with the sun at
+// elevation degrees, using the Haurwitz model.
+func ClearSkyRadiation(elevation float64) float64 {
+	if elevation <= 0 {
+		return 0
+	}
+	cosZenith := math.Sin(radians(elevation))
+	return 1098 * cosZenith * math.Exp(-0.059/cosZenith)
+}
+
+// ReadLastNCloudEstimates estimates the cloud cover at each of the last n records in the cached DbfTable, or at every
+// record when it holds fewer.
+func ReadLastNCloudEstimates(n int) []CloudEstimate {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	n = clampRows(table, n)
+	start := table.NumberOfRecords() - n
+	estimates := make([]CloudEstimate, n)
+	for i := range estimates {
+		estimate := readCloudEstimate(table, i+start)
+		if estimate == nil {
+			return nil
+		}
+		estimates[i] = *estimate
+	}
+	return estimates
+}
+
+// ReadLastNightSky estimates how clear the most recent complete night was, or returns nil if the cached DbfTable
+// does not cover it.
+func ReadLastNightSky() *NightSky {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	dawn, _ := LastNightPeriod(time.Now())
+	dusk := SunTimesOn(dawn.AddDate(0, 0, -1)).CivilDusk
+	return readNightSky(table, dusk, dawn)
+}
+
+// LastNightPeriod returns the civil dawn that ended the most recent complete night at now and the next civil dawn,
+// when another night becomes the most recent.
+func LastNightPeriod(now time.Time) (dawn, next time.Time) {
+	dawn = SunTimesOn(now).CivilDawn
+	if dawn.After(now) {
+		return SunTimesOn(now.AddDate(0, 0, -1)).CivilDawn, dawn
+	}
+	return dawn, SunTimesOn(now.AddDate(0, 0, 1)).CivilDawn
+}
+
+// readNightSky averages the cloud estimates of the rows in table recorded between dusk and dawn.
+func readNightSky(table *godbf.DbfTable, dusk, dawn time.Time) *NightSky {
+	total := table.NumberOfRecords()
+	first := firstRowFrom(table, total, dusk)
+	last := findRowAt(table, total, dawn)
+	if first >= last {
+		return nil
+	}
+	night := &NightSky{Dusk: dusk, Dawn: dawn}
+	for i := first; i <= last; i++ {
+		estimate := readCloudEstimate(table, i)
+		if estimate == nil {
+			return nil
+		}
+		night.CloudCover += estimate.CloudCover
+	}
+	night.CloudCover /= float64(last - first + 1)
+	night.Sky = skyFor(night.CloudCover)
+	evening, err1 := readChannel(table, first, chn1Deg, false)
+	morning, err2 := readChannel(table, last, chn1Deg, false)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	night.Cooling = evening - morning
+	return night
+}
+
+// readCloudEstimate estimates the cloud cover when row n of table was recorded.
+func readCloudEstimate(table *godbf.DbfTable, n int) *CloudEstimate {
+	t, err := readDatetime(table, n)
+	if err != nil {
+		return nil
+	}
+	temp, err1 := readChannel(table, n, chn1Deg, false)
+	dew, err2 := readChannel(table, n, chn1Dew, false)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	estimate := &CloudEstimate{
+		Datetime:           t,
+		SolarElevation:     SolarElevation(t),
+		DewPointDepression: temp - dew,
+	}
+	estimate.ClearSkyRadiation = ClearSkyRadiation(estimate.SolarElevation)
+	if hourAgo := findRowAt(table, n, t.Add(-time.Hour)); hourAgo >= 0 {
+		before, err := readChannel(table, hourAgo, chn1Deg, false)
+		if err != nil {
+			return nil
+		}
+		if then, err := readDatetime(table, hourAgo); err == nil && t.After(then) {
+			estimate.CoolingRate = (before - temp) / t.Sub(then).Hours()
+		}
+	}
+	humid := clamp((dryDepression-estimate.DewPointDepression)/(dryDepression-saturatedDepression), 0, 1)
+	if estimate.SolarElevation > 90-twilightZenith {
+		estimate.CloudCover = humid
+	} else {
+		// Under cloud the night barely cools, so weigh a slow cooling rate as much as a humid station.
+		insulated := 1 - clamp(estimate.CoolingRate/clearCoolingRate, 0, 1)
+		estimate.CloudCover = (humid + insulated) / 2
+	}
+	estimate.Sky = skyFor(estimate.CloudCover)
+	return estimate
+}
+
+// skyFor classifies a cloud cover between 0 and 1.
+func skyFor(cover float64) string {
+	switch {
+	case cover < 0.3:
+		return skyClear
+	case cover < 0.7:
+		return skyPartlyCloudy
+	}
+	return skyOvercast
+}
+
+// clamp limits x to the range lo to hi.
+func clamp(x, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, x))
+}
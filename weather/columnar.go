@@ -0,0 +1,90 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/EntilZha/chapelco-weather-goajs/columnar"
+)
+
+// columnarBatchRows is how many rows go into each Parquet row group or Arrow record batch.
+const columnarBatchRows = 8192
+
+// ExportColumns writes every record in the cached DbfTable recorded from from up to but not including to to w in the
+// columnar format, "parquet" or "arrow", limited to fields. Unless raw is set calibrations are applied.
+func ExportColumns(format string, w io.Writer, from, to time.Time, fields []Field, raw bool) error {
+	schema := make([]columnar.ColumnSpec, len(fields))
+	for i, f := range fields {
+		schema[i] = columnar.ColumnSpec{Name: f.Name, Type: columnar.Float64, Unit: f.Unit}
+		if f.Column == dateTime {
+			schema[i].Type = columnar.Timestamp
+		}
+	}
+	var bw columnar.BatchWriter
+	var err error
+	switch format {
+	case "parquet":
+		bw, err = columnar.NewParquetWriter(w, schema)
+	case "arrow":
+		bw, err = columnar.NewArrowWriter(w, schema)
+	default:
+		err = errors.New("weather: unknown columnar format \"" + format + "\"")
+	}
+	if err != nil {
+		return err
+	}
+	table, err := getDbf()
+	if err != nil {
+		return err
+	}
+	total := table.NumberOfRecords()
+	columns := newBatch(schema)
+	temps := newMeanTemperatures(table, raw)
+	for i := firstRowFrom(table, total, from); i < total; i++ {
+		record := readWeatherRecordFromDbf(table, i, raw, temps)
+		if record == nil {
+			return errors.New("weather: could not read record " + strconv.Itoa(i))
+		}
+		if !record.Datetime.Before(to) {
+			break
+		}
+		for j, f := range fields {
+			switch v := f.Value(record).(type) {
+			case time.Time:
+				columns[j].Int64s = append(columns[j].Int64s, unixMillis(v))
+			case float64:
+				columns[j].Float64s = append(columns[j].Float64s, v)
+			}
+		}
+		if columns[0].Len() == columnarBatchRows {
+			if err := bw.WriteBatch(columns); err != nil {
+				return err
+			}
+			columns = newBatch(schema)
+		}
+	}
+	if columns[0].Len() > 0 {
+		if err := bw.WriteBatch(columns); err != nil {
+			return err
+		}
+	}
+	return bw.Close()
+}
+
+// newBatch returns empty columns for schema with room for a full batch.
+func newBatch(schema []columnar.ColumnSpec) []columnar.Column {
+	columns := make([]columnar.Column, len(schema))
+	for i, spec := range schema {
+		if spec.Type == columnar.Timestamp {
+			columns[i].Int64s = make([]int64, 0, columnarBatchRows)
+		} else {
+			columns[i].Float64s = make([]float64, 0, columnarBatchRows)
+		}
+	}
+	return columns
+}
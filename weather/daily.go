@@ -0,0 +1,165 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"math"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// DailySummary condenses the observations of one local Date. Precipitation is the rise of RAIN_SUM over the day,
+// and Sun gives the solar context for interpreting the temperature curve.
+type DailySummary struct {
+	Date                string
+	Observations        int
+	MinTemperature      float64
+	MaxTemperature      float64
+	MeanTemperature     float64
+	MinDewPoint         float64
+	MaxDewPoint         float64
+	MinRelativeHumidity float64
+	MaxRelativeHumidity float64
+	Precipitation       float64
+	Sun                 SunTimes
+}
+
+// ReadLastNDailySummaries summarizes the last n local days in the cached DbfTable, today included, oldest first.
+// Days without observations are left out.
+func ReadLastNDailySummaries(n int) []DailySummary {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	today := LocalMidnight(time.Now())
+	return ReadDailySummariesFromDbf(table, today.AddDate(0, 0, 1-n), today.AddDate(0, 0, 1))
+}
+
+// ReadDailySummaries summarizes each local day with observations in the cached DbfTable from from up to but not
+// including to, oldest first.
+func ReadDailySummaries(from, to time.Time) []DailySummary {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	return ReadDailySummariesFromDbf(table, from, to)
+}
+
+// ReadDailySummary summarizes the local day containing day from the cached DbfTable, or returns nil if there are no
+// observations on it.
+func ReadDailySummary(day time.Time) *DailySummary {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	midnight := LocalMidnight(day)
+	summaries := ReadDailySummariesFromDbf(table, midnight, midnight.AddDate(0, 0, 1))
+	if len(summaries) == 0 {
+		return nil
+	}
+	return &summaries[0]
+}
+
+// ReadDailySummariesFromDbf summarizes each local day with observations in table from from up to but not including
+// to, oldest first.
+func ReadDailySummariesFromDbf(table *godbf.DbfTable, from, to time.Time) []DailySummary {
+	total := table.NumberOfRecords()
+	start := firstRowFrom(table, total, from)
+	summaries := make([]DailySummary, 0)
+	var summary *DailySummary
+	var lastRain float64
+	for i := start; i < total; i++ {
+		t, err := readDatetime(table, i)
+		if err != nil {
+			return nil
+		}
+		if !t.Before(to) {
+			break
+		}
+		temp, err1 := readChannel(table, i, chn1Deg, false)
+		dew, err2 := readChannel(table, i, chn1Dew, false)
+		humidity, err3 := readChannel(table, i, chn1Rf, false)
+		rain, err4 := readChannel(table, i, rainSum, false)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil
+		}
+		date := t.In(StationTimezone).Format("2006-01-02")
+		if summary == nil || summary.Date != date {
+			if summary != nil {
+				summary.MeanTemperature /= float64(summary.Observations)
+				summaries = append(summaries, *summary)
+			}
+			summary = &DailySummary{
+				Date:                date,
+				MinTemperature:      math.Inf(1),
+				MaxTemperature:      math.Inf(-1),
+				MinDewPoint:         math.Inf(1),
+				MaxDewPoint:         math.Inf(-1),
+				MinRelativeHumidity: math.Inf(1),
+				MaxRelativeHumidity: math.Inf(-1),
+				Sun:                 SunTimesOn(t),
+			}
+			if i == start {
+				lastRain = rain
+			}
+		}
+		summary.Observations++
+		summary.MinTemperature = math.Min(summary.MinTemperature, temp)
+		summary.MaxTemperature = math.Max(summary.MaxTemperature, temp)
+		summary.MeanTemperature += temp
+		summary.MinDewPoint = math.Min(summary.MinDewPoint, dew)
+		summary.MaxDewPoint = math.Max(summary.MaxDewPoint, dew)
+		summary.MinRelativeHumidity = math.Min(summary.MinRelativeHumidity, humidity)
+		summary.MaxRelativeHumidity = math.Max(summary.MaxRelativeHumidity, humidity)
+		// RAIN_SUM only grows, except when the logger resets it, so only rises count as precipitation.
+		if rain > lastRain {
+			summary.Precipitation += rain - lastRain
+		}
+		lastRain = rain
+	}
+	if summary != nil {
+		summary.MeanTemperature /= float64(summary.Observations)
+		summaries = append(summaries, *summary)
+	}
+	return summaries
+}
+
+// ReadRainBetween reads the precipitation in mm recorded in the cached DbfTable after from up to and including to.
+func ReadRainBetween(from, to time.Time) float64 {
+	table, err := getDbf()
+	if err != nil {
+		return 0
+	}
+	total := table.NumberOfRecords()
+	start := findRowAt(table, total, from)
+	end := findRowAt(table, total, to)
+	if start < 0 {
+		start = 0
+	}
+	var rain, last float64
+	for i := start; i <= end; i++ {
+		value, err := readChannel(table, i, rainSum, false)
+		if err != nil {
+			return 0
+		}
+		// As in daily summaries, only rises of the running total count, so a reset does not subtract rain.
+		if i > start && value > last {
+			rain += value - last
+		}
+		last = value
+	}
+	return rain
+}
+
+// LocalMidnight returns the start of the station's local day containing t.
+func LocalMidnight(t time.Time) time.Time {
+	local := t.In(StationTimezone)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, StationTimezone)
+}
+
+// firstRowFrom returns the first of the first n rows recorded at or after t, or n if there is none.
+func firstRowFrom(table *godbf.DbfTable, n int, t time.Time) int {
+	return findRowAt(table, n, t.Add(-time.Nanosecond)) + 1
+}
@@ -0,0 +1,188 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// exportFlushRows is how many rows are encoded between flushes while exporting, so that large exports reach the
+// client as they are read instead of all at once.
+const exportFlushRows = 500
+
+// RecordEncoder writes WeatherRecords in one export format. WriteHeader is called once before the first record and
+// Flush after the last.
+type RecordEncoder interface {
+	WriteHeader(fields []Field) error
+	Encode(record *WeatherRecord) error
+	Flush() error
+}
+
+// ExportFormat describes an export format by its file Extension and ContentType. Columnar formats are written with
+// ExportColumns, the others with ExportRecords.
+type ExportFormat struct {
+	Extension   string
+	ContentType string
+	Columnar    bool
+}
+
+// ExportFormats are the supported export formats keyed by name.
+var ExportFormats = map[string]ExportFormat{
+	"csv":     {"csv", "text/csv; charset=utf-8", false},
+	"tsv":     {"tsv", "text/tab-separated-values; charset=utf-8", false},
+	"ndjson":  {"ndjson", "application/x-ndjson", false},
+	"line":    {"lp", "text/plain; charset=utf-8", false},
+	"parquet": {"parquet", "application/vnd.apache.parquet", true},
+	"arrow":   {"arrows", "application/vnd.apache.arrow.stream", true},
+}
+
+// NewRecordEncoder returns an encoder writing format to w. delimiter separates values in the csv format, where 0
+// means a comma, and is ignored by the other formats.
+func NewRecordEncoder(format string, w io.Writer, delimiter rune) (RecordEncoder, error) {
+	switch format {
+	case "csv":
+		if delimiter == 0 {
+			delimiter = ','
+		}
+		if !ValidDelimiter(delimiter) {
+			return nil, errors.New("weather: invalid csv delimiter " + strconv.QuoteRune(delimiter))
+		}
+		return newDelimitedEncoder(w, delimiter), nil
+	case "tsv":
+		return newDelimitedEncoder(w, '\t'), nil
+	case "ndjson":
+		return &ndjsonEncoder{w: bufio.NewWriter(w)}, nil
+	case "line":
+		return &lineProtocolEncoder{w: bufio.NewWriter(w)}, nil
+	}
+	return nil, errors.New("weather: unknown export format \"" + format + "\"")
+}
+
+// ValidDelimiter reports whether r can separate values in the csv format: any character but a quote, a line break or
+// the Unicode replacement character.
+func ValidDelimiter(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+// ExportRecords streams every record in the cached DbfTable recorded from from up to but not including to through
+// enc, limited to fields. Unless raw is set calibrations are applied.
+func ExportRecords(enc RecordEncoder, from, to time.Time, fields []Field, raw bool) error {
+	table, err := getDbf()
+	if err != nil {
+		return err
+	}
+	if err := enc.WriteHeader(fields); err != nil {
+		return err
+	}
+	total := table.NumberOfRecords()
+	temps := newMeanTemperatures(table, raw)
+	for i := firstRowFrom(table, total, from); i < total; i++ {
+		record := readWeatherRecordFromDbf(table, i, raw, temps)
+		if record == nil {
+			return errors.New("weather: could not read record " + strconv.Itoa(i))
+		}
+		if !record.Datetime.Before(to) {
+			break
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+		if i%exportFlushRows == 0 {
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return enc.Flush()
+}
+
+// ParseTime parses value as an RFC 3339 time, or as a date which is taken as midnight in the station's timezone.
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, StationTimezone); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// delimitedEncoder writes records as delimiter separated values under a header row of unit annotated field names.
+type delimitedEncoder struct {
+	w      *csv.Writer
+	fields []Field
+}
+
+func newDelimitedEncoder(w io.Writer, delimiter rune) *delimitedEncoder {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	return &delimitedEncoder{w: writer}
+}
+
+func (e *delimitedEncoder) WriteHeader(fields []Field) error {
+	e.fields = fields
+	header := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.Label()
+	}
+	return e.w.Write(header)
+}
+
+func (e *delimitedEncoder) Encode(record *WeatherRecord) error {
+	row := make([]string, len(e.fields))
+	for i, f := range e.fields {
+		row[i] = formatValue(f.Value(record))
+	}
+	return e.w.Write(row)
+}
+
+func (e *delimitedEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonEncoder writes each record as a JSON object on its own line, keyed by field name.
+type ndjsonEncoder struct {
+	w      *bufio.Writer
+	fields []Field
+}
+
+func (e *ndjsonEncoder) WriteHeader(fields []Field) error {
+	e.fields = fields
+	return nil
+}
+
+func (e *ndjsonEncoder) Encode(record *WeatherRecord) error {
+	row := make(map[string]interface{}, len(e.fields))
+	for _, f := range e.fields {
+		row[f.Name] = f.Value(record)
+	}
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if _, err := e.w.Write(line); err != nil {
+		return err
+	}
+	return e.w.WriteByte('\n')
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// formatValue formats a field value for text exports.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
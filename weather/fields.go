@@ -0,0 +1,127 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// Field describes one value of a WeatherRecord: its Name in the record, the Column it is keyed by in the dbf file
+// and field lists, and the Unit it is measured in.
+type Field struct {
+	Name   string
+	Column string
+	Unit   string
+}
+
+// Fields lists every field of a WeatherRecord in the order they are exported.
+var Fields = []Field{
+	{"Datetime", dateTime, ""},
+	{"Temperature", chn1Deg, "°C"},
+	{"DewPoint", chn1Dew, "°C"},
+	{"RelativeHumidity", chn1Rf, "%"},
+	{"RainSum", rainSum, "mm"},
+	{"LocalPressure", presLoc, "hPa"},
+	{"AbsolutePressure", presAbs, "hPa"},
+	{"SeaLevelPressure", presMsl, "hPa"},
+	{"AltimeterSetting", presQnh, "hPa"},
+}
+
+// LookupField returns the field whose Name or Column matches name, ignoring case.
+func LookupField(name string) (Field, bool) {
+	for _, f := range Fields {
+		if strings.EqualFold(f.Name, name) || strings.EqualFold(f.Column, name) {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// ParseFields parses a comma separated list of field names. An empty list selects every field. Datetime is always
+// included first since rows are meaningless without it.
+func ParseFields(list string) ([]Field, error) {
+	if strings.TrimSpace(list) == "" {
+		return Fields, nil
+	}
+	fields := []Field{Fields[0]}
+	for _, name := range strings.Split(list, ",") {
+		f, ok := LookupField(strings.TrimSpace(name))
+		if !ok {
+			return nil, errors.New("weather: unknown field \"" + strings.TrimSpace(name) + "\"")
+		}
+		if f.Column != dateTime {
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// DiscoverFields returns the fields of the cached DbfTable: Fields followed by a Field for every other numeric column
+// in the file. Discovered columns are named after the column and have no unit.
+func DiscoverFields() []Field {
+	table, err := getDbf()
+	if err != nil {
+		return Fields
+	}
+	return discoverFields(table)
+}
+
+// discoverFields returns Fields followed by the numeric columns of table that are not in Fields.
+func discoverFields(table *godbf.DbfTable) []Field {
+	fields := append([]Field(nil), Fields...)
+	for _, column := range table.Fields() {
+		name := column.FieldName()
+		if _, known := LookupField(name); known || (column.FieldType() != "N" && column.FieldType() != "F") {
+			continue
+		}
+		fields = append(fields, Field{name, name, ""})
+	}
+	return fields
+}
+
+// Discovered reports whether f is a column found in the dbf file rather than a field of WeatherRecord.
+func (f Field) Discovered() bool {
+	_, known := LookupField(f.Name)
+	return !known
+}
+
+// Value returns the value of f in record, or nil for discovered fields which records do not hold.
+func (f Field) Value(record *WeatherRecord) interface{} {
+	value := reflect.ValueOf(record).Elem().FieldByName(f.Name)
+	if !value.IsValid() {
+		return nil
+	}
+	return value.Interface()
+}
+
+// SnakeName returns the name of f in snake case, such as "dew_point", for formats that use lower case keys.
+func (f Field) SnakeName() string {
+	if f.Discovered() {
+		return strings.ToLower(f.Name)
+	}
+	var name []rune
+	for i, r := range f.Name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				name = append(name, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		name = append(name, r)
+	}
+	return string(name)
+}
+
+// Label returns the name of f annotated with its unit, such as "Temperature (°C)".
+func (f Field) Label() string {
+	if f.Unit == "" {
+		return f.Name
+	}
+	return f.Name + " (" + f.Unit + ")"
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StationName labels the station in metrics and line protocol exports.
+var StationName = "chapelco"
+
+// metricUnits are the suffixes Prometheus metric names take for each unit.
+var metricUnits = map[string]string{
+	"°C":  "celsius",
+	"%":   "percent",
+	"mm":  "millimeters",
+	"hPa": "hectopascals",
+}
+
+// ChannelReading is the latest value of one channel of the station.
+type ChannelReading struct {
+	Field    Field
+	Datetime time.Time
+	Value    float64
+}
+
+// ReadLatestChannels reads the most recent value of every channel in the cached DbfTable, discovered columns
+// included.
+func ReadLatestChannels() ([]ChannelReading, error) {
+	table, err := getDbf()
+	if err != nil {
+		return nil, err
+	}
+	n := table.NumberOfRecords() - 1
+	record := ReadWeatherRecordFromDbf(table, n)
+	if record == nil {
+		return nil, errors.New("weather: could not read record " + strconv.Itoa(n))
+	}
+	var readings []ChannelReading
+	for _, f := range discoverFields(table) {
+		reading := ChannelReading{Field: f, Datetime: record.Datetime}
+		if f.Column == dateTime {
+			continue
+		} else if f.Discovered() {
+			if reading.Value, err = table.Float64FieldValueByName(n, f.Column); err != nil {
+				continue
+			}
+		} else {
+			reading.Value = f.Value(record).(float64)
+		}
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
+
+// WritePrometheus writes the latest value of every channel to w in the Prometheus text exposition format. Known
+// channels get a gauge of their own, named with their unit, while discovered columns share a gauge labelled by
+// column.
+func WritePrometheus(w io.Writer) error {
+	readings, err := ReadLatestChannels()
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+	labels := `station="` + StationName + `"`
+	var discovered []ChannelReading
+	for _, r := range readings {
+		if r.Field.Discovered() {
+			discovered = append(discovered, r)
+			continue
+		}
+		name := "weather_" + r.Field.SnakeName()
+		if unit, ok := metricUnits[r.Field.Unit]; ok {
+			name += "_" + unit
+		}
+		fmt.Fprintf(buf, "# HELP %s %s in %s (%s).\n", name, r.Field.Name, r.Field.Unit, r.Field.Column)
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(buf, "%s{%s} %s %d\n", name, labels, formatValue(r.Value), unixMillis(r.Datetime))
+	}
+	if len(discovered) > 0 {
+		fmt.Fprintln(buf, "# HELP weather_channel Value of a station column without a known meaning.")
+		fmt.Fprintln(buf, "# TYPE weather_channel gauge")
+		for _, r := range discovered {
+			fmt.Fprintf(buf, "weather_channel{%s,column=%q} %s %d\n", labels, r.Field.Column, formatValue(r.Value),
+				unixMillis(r.Datetime))
+		}
+	}
+	if len(readings) > 0 {
+		fmt.Fprintln(buf, "# HELP weather_observation_timestamp_seconds Time of the latest observation.")
+		fmt.Fprintln(buf, "# TYPE weather_observation_timestamp_seconds gauge")
+		fmt.Fprintf(buf, "weather_observation_timestamp_seconds{%s} %d\n", labels, readings[0].Datetime.Unix())
+	}
+	return buf.Flush()
+}
+
+// lineProtocolEncoder writes each record as an InfluxDB line protocol point in the weather measurement, tagged with
+// the station and timestamped in nanoseconds.
+type lineProtocolEncoder struct {
+	w      *bufio.Writer
+	fields []Field
+}
+
+func (e *lineProtocolEncoder) WriteHeader(fields []Field) error {
+	e.fields = fields
+	return nil
+}
+
+func (e *lineProtocolEncoder) Encode(record *WeatherRecord) error {
+	values := make([]string, 0, len(e.fields))
+	for _, f := range e.fields {
+		if v, ok := f.Value(record).(float64); ok {
+			values = append(values, f.SnakeName()+"="+strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(e.w, "weather,station=%s %s %d\n", escapeTag(StationName), strings.Join(values, ","),
+		record.Datetime.UnixNano())
+	return err
+}
+
+func (e *lineProtocolEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// escapeTag escapes the characters that are special in line protocol tag values.
+func escapeTag(s string) string {
+	return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(s)
+}
+
+// unixMillis returns t as milliseconds since the Unix epoch.
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// PageInfo locates a page of records in the history. First and Last are the Datetimes of its oldest and newest
+// record; Older and Newer report whether records exist before and after it.
+type PageInfo struct {
+	First, Last  time.Time
+	Older, Newer bool
+}
+
+// ReadRecordsPage reads up to limit records from the cached DbfTable, oldest first. Forward pages hold the records
+// recorded after from; backward pages those recorded before from, or the latest records when from is zero. Unless
+// raw is set calibrations are applied.
+func ReadRecordsPage(from time.Time, forward bool, limit int, raw bool) ([]WeatherRecord, PageInfo, error) {
+	table, err := getDbf()
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	start, end, info, err := pageRows(table, from, forward, limit)
+	if err != nil {
+		return nil, info, err
+	}
+	records := make([]WeatherRecord, 0, end-start)
+	temps := newMeanTemperatures(table, raw)
+	for i := start; i < end; i++ {
+		record := readWeatherRecordFromDbf(table, i, raw, temps)
+		if record == nil {
+			return nil, info, errors.New("weather: could not read record " + strconv.Itoa(i))
+		}
+		records = append(records, *record)
+	}
+	return records, info, nil
+}
+
+// ReadSparseRecordsPage reads a page of records like ReadRecordsPage, limited to fields as in ReadLastNSparseRecords.
+func ReadSparseRecordsPage(from time.Time, forward bool, limit int, fields []Field, raw bool) ([]map[string]interface{}, PageInfo, error) {
+	table, err := getDbf()
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	start, end, info, err := pageRows(table, from, forward, limit)
+	if err != nil {
+		return nil, info, err
+	}
+	records := make([]map[string]interface{}, 0, end-start)
+	temps := newMeanTemperatures(table, raw)
+	for i := start; i < end; i++ {
+		record := make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			if record[f.Name], err = readField(table, i, f, raw, temps); err != nil {
+				return nil, info, err
+			}
+		}
+		records = append(records, record)
+	}
+	return records, info, nil
+}
+
+// pageRows returns the range of rows start up to but not including end of a page of table and describes it.
+func pageRows(table *godbf.DbfTable, from time.Time, forward bool, limit int) (int, int, PageInfo, error) {
+	total := table.NumberOfRecords()
+	var start, end int
+	switch {
+	case forward:
+		start = findRowAt(table, total, from) + 1
+		end = start + limit
+		if end > total {
+			end = total
+		}
+	case from.IsZero():
+		end = total
+		start = end - limit
+	default:
+		end = firstRowFrom(table, total, from)
+		start = end - limit
+	}
+	if start < 0 {
+		start = 0
+	}
+	info := PageInfo{Older: start > 0, Newer: end < total}
+	if start < end {
+		var err1, err2 error
+		info.First, err1 = readDatetime(table, start)
+		info.Last, err2 = readDatetime(table, end-1)
+		if err1 != nil || err2 != nil {
+			return 0, 0, info, errors.New("weather: could not read page dates")
+		}
+	}
+	return start, end, info, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// StationElevation is the height of the weather station above mean sea level in meters, set from the server's
+// configuration before pressures are read. The station sits at Puesto Fijo, mid-mountain on Chapelco.
+var StationElevation = 1700.0
+
+// Keys of the derived pressure lists in ReadLastNWeatherRecordsToMap, named in the style of the dbf columns.
+const (
+	presMsl = "PRES_MSL"
+	presQnh = "PRES_QNH"
+)
+
+// Physical constants used to reduce station pressure to sea level.
+const (
+	gravity       = 9.80665 // standard gravity, m/s^2
+	gasConstant   = 287.05  // specific gas constant of dry air, J/(kg K)
+	lapseRate     = 0.0065  // standard atmosphere lapse rate, K/m
+	celsiusKelvin = 273.15
+)
+
+// SeaLevelPressure reduces the station pressure in hPa to mean sea level with the hypsometric equation. meanTemp is
+// the mean station temperature in °C over the last 12 hours, which is extended down to sea level with the standard
+// lapse rate to estimate the mean temperature of the fictitious air column below the station.
+func SeaLevelPressure(stationPressure, meanTemp float64) float64 {
+	columnTemp := meanTemp + celsiusKelvin + lapseRate*StationElevation/2
+	return stationPressure * math.Exp(gravity*StationElevation/(gasConstant*columnTemp))
+}
+
+// AltimeterSetting returns the QNH in hPa for the station pressure in hPa, following the standard atmosphere
+// reduction used by aviation altimeters.
+func AltimeterSetting(stationPressure float64) float64 {
+	const n = 0.190284
+	p := stationPressure - 0.3
+	return p * math.Pow(1+math.Pow(1013.25, n)*lapseRate/288*StationElevation/math.Pow(p, n), 1/n)
+}
+
+// ReadLastNSeaLevelPressures reads the last n PRES_ABS records reduced to mean sea level.
+func ReadLastNSeaLevelPressures(table *godbf.DbfTable, n int) []float64 {
+	return readLastNSeaLevelPressures(table, n, false)
+}
+
+// ReadLastNAltimeterSettings reads the last n PRES_ABS records as QNH altimeter settings.
+func ReadLastNAltimeterSettings(table *godbf.DbfTable, n int) []float64 {
+	return readLastNAltimeterSettings(table, n, false)
+}
+
+// readLastNSeaLevelPressures reduces the last n PRES_ABS records to sea level, applying calibrations unless raw is
+// set.
+func readLastNSeaLevelPressures(table *godbf.DbfTable, n int, raw bool) []float64 {
+	pressures := readLastNFromFloat64Field(table, n, presAbs, raw)
+	if pressures == nil {
+		return nil
+	}
+	start := table.NumberOfRecords() - n
+	temps := newMeanTemperatures(table, raw)
+	for i := range pressures {
+		meanTemp, err := temps.read(i + start)
+		if err != nil {
+			return nil
+		}
+		pressures[i] = SeaLevelPressure(pressures[i], meanTemp)
+	}
+	return pressures
+}
+
+// readLastNAltimeterSettings converts the last n PRES_ABS records to QNH, applying calibrations unless raw is set.
+func readLastNAltimeterSettings(table *godbf.DbfTable, n int, raw bool) []float64 {
+	pressures := readLastNFromFloat64Field(table, n, presAbs, raw)
+	for i := range pressures {
+		pressures[i] = AltimeterSetting(pressures[i])
+	}
+	return pressures
+}
+
+// meanTemperatureSlack is how far from 12 hours before a row the earlier temperature averaged with it may have been
+// recorded, so that after a gap in the logger data a reading days old is not taken for it.
+const meanTemperatureSlack = time.Hour
+
+// meanTemperatures reads the mean temperatures of the rows of table that SeaLevelPressure needs, applying
+// calibrations unless raw is set. Reading rows in increasing order, as lists of records do, follows the row 12 hours
+// earlier forward instead of searching the table for it again for every row.
+type meanTemperatures struct {
+	table *godbf.DbfTable
+	raw   bool
+	// last is the row last read, -1 before the first. earlier is the last row recorded at or before 12 hours before
+	// it, -1 if there is none, and earlierTime when it was recorded.
+	last        int
+	earlier     int
+	earlierTime time.Time
+}
+
+// newMeanTemperatures returns a meanTemperatures reading table.
+func newMeanTemperatures(table *godbf.DbfTable, raw bool) *meanTemperatures {
+	return &meanTemperatures{table: table, raw: raw, last: -1, earlier: -1}
+}
+
+// read returns the mean of the temperature at row n and the temperature 12 hours earlier. When the table holds no
+// temperature within meanTemperatureSlack of 12 hours earlier the temperature at row n is used alone.
+func (m *meanTemperatures) read(n int) (float64, error) {
+	t, err := readDatetime(m.table, n)
+	if err != nil {
+		return 0, err
+	}
+	now, err := readChannel(m.table, n, chn1Deg, m.raw)
+	if err != nil {
+		return 0, err
+	}
+	target := t.Add(-12 * time.Hour)
+	if n < m.last || m.last < 0 {
+		m.earlier, m.earlierTime = findRowAt(m.table, n, target), time.Time{}
+		if m.earlier >= 0 {
+			if m.earlierTime, err = readDatetime(m.table, m.earlier); err != nil {
+				return 0, err
+			}
+		}
+	}
+	m.last = n
+	for m.earlier+1 < n {
+		next, err := readDatetime(m.table, m.earlier+1)
+		if err != nil {
+			return 0, err
+		}
+		if next.After(target) {
+			break
+		}
+		m.earlier, m.earlierTime = m.earlier+1, next
+	}
+	if m.earlier < 0 || target.Sub(m.earlierTime) > meanTemperatureSlack {
+		return now, nil
+	}
+	then, err := readChannel(m.table, m.earlier, chn1Deg, m.raw)
+	if err != nil {
+		return 0, err
+	}
+	return (now + then) / 2, nil
+}
+
+// readChannel reads channel at row n, applying calibrations unless raw is set.
+func readChannel(table *godbf.DbfTable, n int, channel string, raw bool) (float64, error) {
+	value, err := table.Float64FieldValueByName(n, channel)
+	if err != nil || raw || !hasCalibrations(channel) {
+		return value, err
+	}
+	t, err := readDatetime(table, n)
+	if err != nil {
+		return 0, err
+	}
+	return calibrate(channel, t, value), nil
+}
+
+// findRowAt returns the last of the first n rows recorded at or before t, or -1 if there is none.
+func findRowAt(table *godbf.DbfTable, n int, t time.Time) int {
+	return sort.Search(n, func(i int) bool {
+		rowTime, err := readDatetime(table, i)
+		return err != nil || rowTime.After(t)
+	}) - 1
+}
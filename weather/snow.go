@@ -0,0 +1,117 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+// snowRatios are the snow to liquid ratios assumed for precipitation falling at or below each temperature in °C,
+// from wet snow near freezing to dry powder in the cold. Precipitation above the warmest temperature is rain. The
+// station has no snow depth sensor, so they are climatological rules of thumb rather than measurements.
+var snowRatios = []struct {
+	temperature float64
+	ratio       float64
+}{
+	{-14, 20},
+	{-8, 17},
+	{-3, 13},
+	{0, 10},
+	{1.5, 7},
+}
+
+// SnowEstimate is the new snow estimated from the precipitation between From and To. Precipitation is all the water
+// that fell in mm, SnowWater the part of it that fell cold enough to be snow and Depth the estimated depth of new
+// snow in cm.
+type SnowEstimate struct {
+	From          time.Time
+	To            time.Time
+	Precipitation float64
+	SnowWater     float64
+	Depth         float64
+}
+
+// EstimateNewSnow estimates the snow that fell after from up to and including to from the cached DbfTable. Each rise
+// of the rain gauge is taken to have fallen at the mean temperature of the two readings around it.
+func EstimateNewSnow(from, to time.Time) SnowEstimate {
+	estimate := SnowEstimate{From: from, To: to}
+	table, err := getDbf()
+	if err != nil {
+		return estimate
+	}
+	total := table.NumberOfRecords()
+	start := findRowAt(table, total, from)
+	end := findRowAt(table, total, to)
+	if start < 0 {
+		start = 0
+	}
+	var lastRain, lastTemp float64
+	for i := start; i <= end; i++ {
+		rain, err1 := readChannel(table, i, rainSum, false)
+		temp, err2 := readChannel(table, i, chn1Deg, false)
+		if err1 != nil || err2 != nil {
+			return estimate
+		}
+		// As in daily summaries, only rises of the running total count, so a reset does not subtract rain.
+		if i > start && rain > lastRain {
+			water := rain - lastRain
+			estimate.Precipitation += water
+			if ratio := snowRatio((temp + lastTemp) / 2); ratio > 0 {
+				estimate.SnowWater += water
+				// Water in mm times the ratio is snow in mm, a tenth of which is cm.
+				estimate.Depth += water * ratio / 10
+			}
+		}
+		lastRain, lastTemp = rain, temp
+	}
+	return estimate
+}
+
+// snowRatio returns the snow to liquid ratio of precipitation falling at temperature, 0 for rain.
+func snowRatio(temperature float64) float64 {
+	for _, r := range snowRatios {
+		if temperature <= r.temperature {
+			return r.ratio
+		}
+	}
+	return 0
+}
+
+// ReadTemperatureRange reads the lowest and highest temperatures recorded from from up to and including to in the
+// cached DbfTable. ok is false when there are no readings in between.
+func ReadTemperatureRange(from, to time.Time) (low, high float64, ok bool) {
+	table, err := getDbf()
+	if err != nil {
+		return 0, 0, false
+	}
+	total := table.NumberOfRecords()
+	end := findRowAt(table, total, to)
+	low, high = math.Inf(1), math.Inf(-1)
+	for i := firstRowFrom(table, total, from); i <= end; i++ {
+		temp, err := readChannel(table, i, chn1Deg, false)
+		if err != nil {
+			return 0, 0, false
+		}
+		low, high = math.Min(low, temp), math.Max(high, temp)
+	}
+	if math.IsInf(low, 1) {
+		return 0, 0, false
+	}
+	return low, high, true
+}
+
+// ReadCodedObservationAt reads the last record at or before t from the cached DbfTable along with its pressure
+// tendency, precipitation and cloud cover, or returns nil if there is none.
+func ReadCodedObservationAt(t time.Time) *CodedObservation {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	n := findRowAt(table, table.NumberOfRecords(), t)
+	if n < 0 {
+		return nil
+	}
+	return readCodedObservation(table, n)
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// testRow is a reading of the rain gauge and temperature for useTable.
+type testRow struct {
+	datetime    time.Time
+	rainSum     float64
+	temperature float64
+}
+
+// useTable makes a table of rows the cached DbfTable, returning a func restoring the previous one. The table is
+// written as a dBase III file with numeric fields of 18 characters, as the station's logger writes them.
+func useTable(t *testing.T, rows []testRow) func() {
+	names := []string{dateTime, rainSum, chn1Deg}
+	const width = 18
+	header := make([]byte, 32, 32+32*len(names)+1)
+	header[0] = 0x03
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(rows)))
+	binary.LittleEndian.PutUint16(header[8:], uint16(cap(header)))
+	binary.LittleEndian.PutUint16(header[10:], uint16(1+width*len(names)))
+	for _, name := range names {
+		field := make([]byte, 32)
+		copy(field, name)
+		field[11], field[16] = 'N', width
+		header = append(header, field...)
+	}
+	data := append(header, 0x0d)
+	for _, row := range rows {
+		// The logger records local wall time as days since 1899-12-30.
+		wall := row.datetime.In(StationTimezone)
+		days := float64(time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0,
+			time.UTC).Unix())/86400 + 25569
+		data = append(data, ' ')
+		for _, value := range []float64{days, row.rainSum, row.temperature} {
+			data = append(data, fmt.Sprintf("%*.8f", width, value)...)
+		}
+	}
+	table, err := godbf.NewFromBytes(append(data, 0x1a), "UTF8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedDbfTable.Lock()
+	old, oldUpdatedAt := cachedDbfTable.DbfTable, cachedDbfTable.updatedAt
+	cachedDbfTable.DbfTable, cachedDbfTable.updatedAt = table, time.Now()
+	cachedDbfTable.Unlock()
+	return func() {
+		cachedDbfTable.Lock()
+		cachedDbfTable.DbfTable, cachedDbfTable.updatedAt = old, oldUpdatedAt
+		cachedDbfTable.Unlock()
+	}
+}
+
+func TestSnowRatio(t *testing.T) {
+	for _, test := range []struct {
+		temperature float64
+		want        float64
+	}{
+		{-30, 20},
+		{-14, 20},
+		{-13.9, 17},
+		{-8, 17},
+		{-7.9, 13},
+		{-3, 13},
+		{-2.9, 10},
+		{0, 10},
+		{0.1, 7},
+		{1.5, 7},
+		{1.6, 0},
+		{20, 0},
+	} {
+		if got := snowRatio(test.temperature); got != test.want {
+			t.Errorf("snowRatio(%v) = %v, want %v", test.temperature, got, test.want)
+		}
+	}
+}
+
+func TestEstimateNewSnow(t *testing.T) {
+	t0 := time.Date(2014, 7, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return t0.Add(time.Duration(minutes) * time.Minute) }
+	defer useTable(t, []testRow{
+		{at(-20), 10, -5},
+		{at(0), 10, -5},
+		// 2 mm falling at a mean of -5 °C, a ratio of 13: 2.6 cm.
+		{at(20), 12, -5},
+		// 1 mm at a mean of -1 °C, a ratio of 10: 1 cm.
+		{at(40), 13, 3},
+		// 3 mm at a mean of 3 °C is rain.
+		{at(60), 16, 3},
+		// A reset of the gauge counts no rain, then 0.5 mm at a mean of -14 °C, a ratio of 20: 1 cm.
+		{at(80), 0, -14},
+		{at(100), 0.5, -14},
+		{at(120), 5, -14},
+	})()
+	for _, test := range []struct {
+		name                       string
+		from, to                   time.Time
+		precipitation, water, snow float64
+	}{
+		{"all", at(0), at(100), 6.5, 3.5, 4.6},
+		{"before the first reading", at(-60), at(20), 2, 2, 2.6},
+		{"rain only", at(40), at(60), 3, 0, 0},
+		{"between readings", at(50), at(70), 3, 0, 0},
+		{"none", at(100), at(100), 0, 0, 0},
+	} {
+		got := EstimateNewSnow(test.from, test.to)
+		if math.Abs(got.Precipitation-test.precipitation) > 1e-9 || math.Abs(got.SnowWater-test.water) > 1e-9 ||
+			math.Abs(got.Depth-test.snow) > 1e-9 {
+			t.Errorf("%s: %v mm with %v mm of snow water and %v cm of snow, want %v, %v and %v", test.name,
+				got.Precipitation, got.SnowWater, got.Depth, test.precipitation, test.water, test.snow)
+		}
+	}
+}
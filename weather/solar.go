@@ -0,0 +1,175 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"math"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// Coordinates of the weather station in degrees, south and west being negative.
+var (
+	StationLatitude  = -40.25
+	StationLongitude = -71.21
+)
+
+// Zenith angles in degrees at which the sun is considered risen and at which civil twilight ends. The sunrise angle
+// allows for refraction and the radius of the solar disc.
+const (
+	sunriseZenith  = 90.833
+	twilightZenith = 96.0
+)
+
+// SunTimes describes the sun over the station on one local Date. Times are zero when the sun never crosses the
+// corresponding angle that day.
+type SunTimes struct {
+	Date          string
+	CivilDawn     time.Time
+	Sunrise       time.Time
+	SolarNoon     time.Time
+	Sunset        time.Time
+	CivilDusk     time.Time
+	NoonElevation float64
+	DaylightHours float64
+}
+
+// PlotBand marks a stretch of a field list, by index, during which the sun was below the horizon. Label is "night"
+// below civil twilight and "twilight" otherwise. From and To fall halfway between rows so bands line up with chart
+// categories.
+type PlotBand struct {
+	From  float64
+	To    float64
+	Label string
+}
+
+// SunTimesOn returns the sunrise, sunset, solar noon and civil twilight at the station on the local date of day.
+func SunTimesOn(day time.Time) SunTimes {
+	local := day.In(StationTimezone)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+	// Solar position changes slowly enough over a day that it is evaluated once, at local noon.
+	noon := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, StationTimezone)
+	declination, eqTime := solarPosition(noon)
+	noonMinutes := 720 - 4*StationLongitude - eqTime
+	times := SunTimes{
+		Date:          local.Format("2006-01-02"),
+		SolarNoon:     midnight.Add(minutes(noonMinutes)),
+		NoonElevation: SolarElevation(midnight.Add(minutes(noonMinutes))),
+	}
+	if ha, ok := hourAngle(declination, sunriseZenith); ok {
+		times.Sunrise = midnight.Add(minutes(noonMinutes - 4*ha))
+		times.Sunset = midnight.Add(minutes(noonMinutes + 4*ha))
+		times.DaylightHours = 8 * ha / 60
+	} else if times.NoonElevation > 0 {
+		times.DaylightHours = 24
+	}
+	if ha, ok := hourAngle(declination, twilightZenith); ok {
+		times.CivilDawn = midnight.Add(minutes(noonMinutes - 4*ha))
+		times.CivilDusk = midnight.Add(minutes(noonMinutes + 4*ha))
+	}
+	return times
+}
+
+// SolarElevation returns the angle of the sun above the horizon at the station at t in degrees, ignoring refraction.
+func SolarElevation(t time.Time) float64 {
+	declination, eqTime := solarPosition(t)
+	utc := t.UTC()
+	utcMinutes := float64(utc.Hour()*60+utc.Minute()) + float64(utc.Second())/60
+	trueSolarTime := math.Mod(utcMinutes+eqTime+4*StationLongitude, 1440)
+	if trueSolarTime < 0 {
+		trueSolarTime += 1440
+	}
+	ha := trueSolarTime/4 - 180
+	lat := radians(StationLatitude)
+	dec := radians(declination)
+	cosZenith := math.Sin(lat)*math.Sin(dec) + math.Cos(lat)*math.Cos(dec)*math.Cos(radians(ha))
+	return 90 - degrees(math.Acos(math.Max(-1, math.Min(1, cosZenith))))
+}
+
+// ReadLastNSunBands reads the DATE_TIME of the last n records from the cached DbfTable and returns the bands of rows
+// recorded with the sun below the horizon.
+func ReadLastNSunBands(n int) []PlotBand {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	return readLastNSunBands(table, n)
+}
+
+// readLastNSunBands returns the night and twilight bands over the last n rows of table.
+func readLastNSunBands(table *godbf.DbfTable, n int) []PlotBand {
+	start := table.NumberOfRecords() - n
+	if start < 0 {
+		return nil
+	}
+	bands := make([]PlotBand, 0)
+	current := ""
+	for i := 0; i < n; i++ {
+		t, err := readDatetime(table, i+start)
+		if err != nil {
+			return nil
+		}
+		label := ""
+		if elevation := SolarElevation(t); elevation < 90-twilightZenith {
+			label = "night"
+		} else if elevation < 90-sunriseZenith {
+			label = "twilight"
+		}
+		if label != current && label != "" {
+			bands = append(bands, PlotBand{float64(i) - 0.5, float64(i) + 0.5, label})
+		} else if label != "" {
+			bands[len(bands)-1].To = float64(i) + 0.5
+		}
+		current = label
+	}
+	return bands
+}
+
+// solarPosition returns the declination of the sun in degrees and the equation of time in minutes at t, following
+// the NOAA solar calculator.
+func solarPosition(t time.Time) (declination, eqTime float64) {
+	julianDay := float64(t.UTC().Unix())/86400 + 2440587.5
+	jc := (julianDay - 2451545) / 36525
+	meanLong := math.Mod(280.46646+jc*(36000.76983+jc*0.0003032), 360)
+	meanAnom := 357.52911 + jc*(35999.05029-0.0001537*jc)
+	eccentricity := 0.016708634 - jc*(0.000042037+0.0000001267*jc)
+	center := math.Sin(radians(meanAnom))*(1.914602-jc*(0.004817+0.000014*jc)) +
+		math.Sin(radians(2*meanAnom))*(0.019993-0.000101*jc) +
+		math.Sin(radians(3*meanAnom))*0.000289
+	omega := radians(125.04 - 1934.136*jc)
+	apparentLong := meanLong + center - 0.00569 - 0.00478*math.Sin(omega)
+	meanObliquity := 23 + (26+(21.448-jc*(46.815+jc*(0.00059-jc*0.001813)))/60)/60
+	obliquity := meanObliquity + 0.00256*math.Cos(omega)
+	declination = degrees(math.Asin(math.Sin(radians(obliquity)) * math.Sin(radians(apparentLong))))
+	y := math.Pow(math.Tan(radians(obliquity/2)), 2)
+	l, m := radians(meanLong), radians(meanAnom)
+	eqTime = 4 * degrees(y*math.Sin(2*l)-2*eccentricity*math.Sin(m)+4*eccentricity*y*math.Sin(m)*math.Cos(2*l)-
+		0.5*y*y*math.Sin(4*l)-1.25*eccentricity*eccentricity*math.Sin(2*m))
+	return declination, eqTime
+}
+
+// hourAngle returns the hour angle in degrees at which the sun reaches zenith, and false if it never does that day.
+func hourAngle(declination, zenith float64) (float64, bool) {
+	lat := radians(StationLatitude)
+	dec := radians(declination)
+	cosHa := math.Cos(radians(zenith))/(math.Cos(lat)*math.Cos(dec)) - math.Tan(lat)*math.Tan(dec)
+	if cosHa < -1 || cosHa > 1 {
+		return 0, false
+	}
+	return degrees(math.Acos(cosHa)), true
+}
+
+// minutes converts a number of minutes to a time.Duration.
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
@@ -0,0 +1,148 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// ParseTableFields parses a comma separated list of field names like ParseFields, but also accepts the columns found
+// in the cached DbfTable by DiscoverFields.
+func ParseTableFields(list string) ([]Field, error) {
+	if strings.TrimSpace(list) == "" {
+		return Fields, nil
+	}
+	available := DiscoverFields()
+	fields := []Field{Fields[0]}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		var found *Field
+		for i, f := range available {
+			if strings.EqualFold(f.Name, name) || strings.EqualFold(f.Column, name) {
+				found = &available[i]
+				break
+			}
+		}
+		if found == nil {
+			return nil, errors.New("weather: unknown field \"" + name + "\"")
+		}
+		if found.Column != dateTime {
+			fields = append(fields, *found)
+		}
+	}
+	return fields, nil
+}
+
+// ReadLastNSparseRecords reads fields of the last n records from the cached DbfTable, each record as a map keyed by
+// field name. Only the columns fields need are decoded. Unless raw is set calibrations are applied.
+func ReadLastNSparseRecords(n int, fields []Field, raw bool) []map[string]interface{} {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	n = clampRows(table, n)
+	start := table.NumberOfRecords() - n
+	records := make([]map[string]interface{}, n)
+	temps := newMeanTemperatures(table, raw)
+	for i := range records {
+		records[i] = make(map[string]interface{}, len(fields))
+		for _, f := range fields {
+			value, err := readField(table, start+i, f, raw, temps)
+			if err != nil {
+				return nil
+			}
+			records[i][f.Name] = value
+		}
+	}
+	return records
+}
+
+// ReadLastNFieldsToMap reads fields of the last n records from the cached DbfTable in separate lists keyed by column,
+// like ReadLastNWeatherRecordsToMap. Only the columns fields need are decoded. Unless raw is set calibrations are
+// applied.
+func ReadLastNFieldsToMap(n int, fields []Field, raw bool) map[string]interface{} {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	n = clampRows(table, n)
+	start := table.NumberOfRecords() - n
+	lists := make(map[string]interface{}, len(fields))
+	temps := newMeanTemperatures(table, raw)
+	for _, f := range fields {
+		if f.Column == dateTime {
+			lists[dateTime] = ReadLastNDateTimes(table, n)
+			continue
+		}
+		values := make([]float64, n)
+		for i := range values {
+			value, err := readField(table, start+i, f, raw, temps)
+			if err != nil {
+				return nil
+			}
+			values[i] = value.(float64)
+		}
+		lists[f.Column] = values
+	}
+	return lists
+}
+
+// readField reads f at row n, decoding only the columns it is derived from and applying calibrations unless raw is
+// set. temps, which reads the mean temperatures sea level pressures need, is only used when f is one.
+func readField(table *godbf.DbfTable, n int, f Field, raw bool, temps *meanTemperatures) (interface{}, error) {
+	switch f.Column {
+	case dateTime:
+		return readDatetime(table, n)
+	case presMsl:
+		pressure, err := readChannel(table, n, presAbs, raw)
+		if err != nil {
+			return nil, err
+		}
+		meanTemp, err := temps.read(n)
+		if err != nil {
+			return nil, err
+		}
+		return SeaLevelPressure(pressure, meanTemp), nil
+	case presQnh:
+		pressure, err := readChannel(table, n, presAbs, raw)
+		if err != nil {
+			return nil, err
+		}
+		return AltimeterSetting(pressure), nil
+	}
+	return readChannel(table, n, f.Column, raw)
+}
+
+// ReadSeries reads the values of f recorded from from up to but not including to in the cached DbfTable, decoding
+// only the columns f needs. Unless raw is set calibrations are applied.
+func ReadSeries(f Field, from, to time.Time, raw bool) ([]time.Time, []float64, error) {
+	table, err := getDbf()
+	if err != nil {
+		return nil, nil, err
+	}
+	total := table.NumberOfRecords()
+	var times []time.Time
+	var values []float64
+	temps := newMeanTemperatures(table, raw)
+	for i := firstRowFrom(table, total, from); i < total; i++ {
+		t, err := readDatetime(table, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !t.Before(to) {
+			break
+		}
+		value, err := readField(table, i, f, raw, temps)
+		if err != nil {
+			return nil, nil, err
+		}
+		times = append(times, t)
+		values = append(values, value.(float64))
+	}
+	return times, values, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"sync"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// maxResumeRecords limits how many missed records ReadWeatherRecordsAfter returns.
+const maxResumeRecords = 1000
+
+// subscribers holds the channels of Subscribe callers.
+var subscribers = struct {
+	sync.Mutex
+	channels map[chan []WeatherRecord]bool
+}{channels: make(map[chan []WeatherRecord]bool)}
+
+func init() {
+	OnRefresh(publishNewRecords)
+}
+
+// Subscribe returns a channel receiving the records brought in by each refresh of the cached DbfTable, as passed to
+// OnNewRecords, and a function that ends the subscription. The channel holds up to buffer refreshes; a subscriber
+// that falls further behind is dropped and its channel closed, so a slow reader never holds up refreshes and can
+// catch up with ReadWeatherRecordsAfter.
+func Subscribe(buffer int) (<-chan []WeatherRecord, func()) {
+	c := make(chan []WeatherRecord, buffer)
+	subscribers.Lock()
+	subscribers.channels[c] = true
+	subscribers.Unlock()
+	return c, func() {
+		subscribers.Lock()
+		if subscribers.channels[c] {
+			delete(subscribers.channels, c)
+			close(c)
+		}
+		subscribers.Unlock()
+	}
+}
+
+// publishNewRecords sends the records of a refresh to every subscriber, reading them only when there are any.
+func publishNewRecords(table *godbf.DbfTable, first int) {
+	subscribers.Lock()
+	empty := len(subscribers.channels) == 0
+	subscribers.Unlock()
+	if empty {
+		return
+	}
+	records := readNewRecords(table, first, time.Time{})
+	if len(records) == 0 {
+		return
+	}
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	for c := range subscribers.channels {
+		select {
+		case c <- records:
+		default:
+			delete(subscribers.channels, c)
+			close(c)
+		}
+	}
+}
+
+// ReadWeatherRecordsAfter reads the records in the cached DbfTable recorded after t, oldest first and with
+// calibrations applied, up to the most recent 1000.
+func ReadWeatherRecordsAfter(t time.Time) []WeatherRecord {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	total := table.NumberOfRecords()
+	first := findRowAt(table, total, t) + 1
+	if total-first > maxResumeRecords {
+		first = total - maxResumeRecords
+	}
+	records := make([]WeatherRecord, 0, total-first)
+	temps := newMeanTemperatures(table, false)
+	for i := first; i < total; i++ {
+		if r := readWeatherRecordFromDbf(table, i, false, temps); r != nil {
+			records = append(records, *r)
+		}
+	}
+	return records
+}
@@ -0,0 +1,196 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"code.google.com/r/skirodriguez-dbf/godbf"
+)
+
+// Identifiers used in coded bulletins. The station has no WMO index or ICAO location indicator, so SYNOP reports
+// mark the index as missing and METAR-style reports use a local identifier.
+var (
+	StationIndex      = "/////"
+	StationIdentifier = "CHPL"
+)
+
+// tendencyThreshold is the smallest pressure change in hPa that counts as rising or falling.
+const tendencyThreshold = 0.1
+
+// CodedObservation is the latest WeatherRecord together with the derived values reported in coded bulletins.
+// PressureTendency is the change in station pressure over the last 3 hours with its WMO code 0200
+// TendencyCharacteristic, Precipitation is the rain over the last 6 hours and CloudOktas the estimated cloud cover,
+// -1 when it cannot be estimated.
+type CodedObservation struct {
+	Record                 WeatherRecord
+	PressureTendency       float64
+	TendencyCharacteristic int
+	Precipitation          float64
+	CloudOktas             int
+}
+
+// ReadCodedObservation reads the most recent record from the cached DbfTable along with its pressure tendency,
+// precipitation and cloud cover.
+func ReadCodedObservation() *CodedObservation {
+	table, err := getDbf()
+	if err != nil {
+		return nil
+	}
+	return readCodedObservation(table, table.NumberOfRecords()-1)
+}
+
+// readCodedObservation reads row n of table as a CodedObservation.
+func readCodedObservation(table *godbf.DbfTable, n int) *CodedObservation {
+	record := ReadWeatherRecordFromDbf(table, n)
+	if record == nil {
+		return nil
+	}
+	obs := &CodedObservation{Record: *record, CloudOktas: -1}
+	mid := findRowAt(table, n, record.Datetime.Add(-90*time.Minute))
+	start := findRowAt(table, n, record.Datetime.Add(-3*time.Hour))
+	if start >= 0 {
+		startPressure, err1 := readChannel(table, start, presAbs, false)
+		midPressure, err2 := readChannel(table, mid, presAbs, false)
+		if err1 == nil && err2 == nil {
+			obs.PressureTendency = record.AbsolutePressure - startPressure
+			obs.TendencyCharacteristic = tendencyCharacteristic(startPressure, midPressure, record.AbsolutePressure)
+		}
+	}
+	if earlier := findRowAt(table, n, record.Datetime.Add(-6*time.Hour)); earlier >= 0 {
+		if rain, err := readChannel(table, earlier, rainSum, false); err == nil && record.RainSum > rain {
+			obs.Precipitation = record.RainSum - rain
+		}
+	}
+	if estimate := readCloudEstimate(table, n); estimate != nil {
+		obs.CloudOktas = int(math.Floor(estimate.CloudCover*8 + 0.5))
+	}
+	return obs
+}
+
+// Synop renders obs as section 0 and 1 of an FM-12 SYNOP report. Wind and visibility are not measured and are
+// reported as missing, as is the wind speed indicator iw. The station type indicator ix is 6, an automatic station
+// that omits the present and past weather group 7.
+func (obs *CodedObservation) Synop() string {
+	r := obs.Record
+	t := r.Datetime.Add(30 * time.Minute).UTC()
+	precipIndicator := 3
+	if obs.Precipitation > 0 {
+		precipIndicator = 1
+	}
+	cloud := "/"
+	if obs.CloudOktas >= 0 {
+		cloud = fmt.Sprint(obs.CloudOktas)
+	}
+	groups := []string{
+		"AAXX",
+		fmt.Sprintf("%02d%02d/", t.Day(), t.Hour()),
+		StationIndex,
+		fmt.Sprintf("%d6///", precipIndicator),
+		cloud + "////",
+		"1" + signedTenths(r.Temperature),
+		"2" + signedTenths(r.DewPoint),
+		fmt.Sprintf("3%04d", tenths(r.AbsolutePressure)%10000),
+		fmt.Sprintf("4%04d", tenths(r.SeaLevelPressure)%10000),
+		fmt.Sprintf("5%d%03d", obs.TendencyCharacteristic, tenths(math.Abs(obs.PressureTendency))),
+	}
+	if obs.Precipitation > 0 {
+		groups = append(groups, fmt.Sprintf("6%s1", precipitationCode(obs.Precipitation)))
+	}
+	return strings.Join(groups, " ") + "="
+}
+
+// Metar renders obs in the style of a METAR report from an automatic station, with the SYNOP style remarks used in
+// North America for sea level pressure, exact temperatures, pressure tendency and precipitation.
+func (obs *CodedObservation) Metar() string {
+	r := obs.Record
+	t := r.Datetime.UTC()
+	groups := []string{
+		"METAR",
+		StationIdentifier,
+		fmt.Sprintf("%02d%02d%02dZ", t.Day(), t.Hour(), t.Minute()),
+		"AUTO",
+		"/////KT",
+		metarTemperature(r.Temperature) + "/" + metarTemperature(r.DewPoint),
+		fmt.Sprintf("Q%04d", int(math.Floor(r.AltimeterSetting))),
+		"RMK",
+		fmt.Sprintf("SLP%03d", tenths(r.SeaLevelPressure)%1000),
+		"T" + signedTenths(r.Temperature) + signedTenths(r.DewPoint),
+		fmt.Sprintf("5%d%03d", obs.TendencyCharacteristic, tenths(math.Abs(obs.PressureTendency))),
+	}
+	if obs.Precipitation > 0 {
+		groups = append(groups, fmt.Sprintf("6%04d", int(math.Floor(obs.Precipitation/25.4*100+0.5))))
+	}
+	return strings.Join(groups, " ") + "="
+}
+
+// tendencyCharacteristic returns the WMO code 0200 characteristic of the pressure tendency given the pressure three
+// hours ago, an hour and a half ago and now.
+func tendencyCharacteristic(start, mid, end float64) int {
+	first, second, total := mid-start, end-mid, end-start
+	switch {
+	case total >= tendencyThreshold:
+		switch {
+		case first < tendencyThreshold:
+			return 3
+		case second >= tendencyThreshold:
+			return 2
+		case second > -tendencyThreshold:
+			return 1
+		}
+		return 0
+	case total <= -tendencyThreshold:
+		switch {
+		case first > -tendencyThreshold:
+			return 8
+		case second <= -tendencyThreshold:
+			return 7
+		case second < tendencyThreshold:
+			return 6
+		}
+		return 5
+	case first >= tendencyThreshold:
+		return 0
+	case first <= -tendencyThreshold:
+		return 5
+	}
+	return 4
+}
+
+// tenths returns x in tenths, rounded.
+func tenths(x float64) int {
+	return int(math.Floor(x*10 + 0.5))
+}
+
+// signedTenths encodes a temperature as the SYNOP or METAR remark sign digit followed by three digits of tenths of a
+// degree.
+func signedTenths(x float64) string {
+	if x < 0 {
+		return fmt.Sprintf("1%03d", tenths(-x))
+	}
+	return fmt.Sprintf("0%03d", tenths(x))
+}
+
+// metarTemperature encodes a temperature in whole degrees, with M marking negative values.
+func metarTemperature(x float64) string {
+	rounded := int(math.Floor(x + 0.5))
+	if rounded < 0 {
+		return fmt.Sprintf("M%02d", -rounded)
+	}
+	return fmt.Sprintf("%02d", rounded)
+}
+
+// precipitationCode encodes a precipitation amount in mm as the SYNOP RRR code.
+func precipitationCode(mm float64) string {
+	if mm < 0.1 {
+		return "990"
+	}
+	if tenths(mm) < 10 {
+		return fmt.Sprintf("99%d", tenths(mm))
+	}
+	return fmt.Sprintf("%03d", int(math.Min(math.Floor(mm+0.5), 989)))
+}
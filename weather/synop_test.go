@@ -0,0 +1,33 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package weather
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSynop(t *testing.T) {
+	record := WeatherRecord{
+		Datetime:         time.Date(2014, 7, 1, 11, 45, 0, 0, time.UTC),
+		AbsolutePressure: 915.3,
+		Temperature:      -2.5,
+		DewPoint:         -4,
+		SeaLevelPressure: 1013.2,
+	}
+	for _, test := range []struct {
+		name string
+		obs  CodedObservation
+		want string
+	}{
+		{"rain and clouds", CodedObservation{Record: record, PressureTendency: 1.2, TendencyCharacteristic: 3,
+			Precipitation: 0.4, CloudOktas: 5}, "AAXX 0112/ ///// 16/// 5//// 11025 21040 39153 40132 53012 69941="},
+		{"dry and no cloud estimate", CodedObservation{Record: record, PressureTendency: -0.4,
+			TendencyCharacteristic: 8, CloudOktas: -1}, "AAXX 0112/ ///// 36/// ///// 11025 21040 39153 40132 58004="},
+	} {
+		if got := test.obs.Synop(); got != test.want {
+			t.Errorf("%s: %q, want %q", test.name, got, test.want)
+		}
+	}
+}
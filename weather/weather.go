@@ -5,15 +5,36 @@
 package weather
 
 import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"code.google.com/r/skirodriguez-dbf/godbf"
 )
 
-// cachedDbfTable holds cached DbfTable. It is only fetched every 20 minutes after it is stale.
+// cachedDbfTable holds cached DbfTable. It is only fetched again once it has been cached for CacheTTL.
 var cachedDbfTable = new(CachedDbfTable)
 
+// Where the DbfTable is read from, set from the server's configuration before it is first read.
+var (
+	// DataURL is the HTTP or HTTPS URL of the station's DBF file, or its path on disk.
+	DataURL = "http://googledrive.com/host/0B06ZoNF0o91ncXRPdVRuZjBDaE0"
+	// DataEncoding is the character encoding of the DBF file.
+	DataEncoding = "UTF8"
+	// CacheTTL is how long the cached DbfTable is used before it is fetched again.
+	CacheTTL = 20 * time.Minute
+	// FetchTimeout is the longest a fetch of the DBF file over HTTP may take, so that a stalled download neither holds
+	// the table locked forever nor keeps the server from shutting down.
+	FetchTimeout = time.Minute
+)
+
+// StationTimezone is the local time kept by the weather station logger, 4 hours behind UTC unless configured
+// otherwise.
+var StationTimezone = time.FixedZone("ART", -4*60*60)
+
 // Constants to access variables from Chapelco weather .dbf file
 const (
 	rainSum  = "RAIN_SUM"
@@ -27,13 +48,16 @@ const (
 
 // CachedDbfTable consists of DbfTable which holds a godbf.DfTable, updatedAt contains the time.Time it was
 // last updated, and holds a Read/Write lock to insure that the table is in sync with when it was last updated.
+// notifying counts the refreshes whose OnRefresh handlers are still running.
 type CachedDbfTable struct {
 	DbfTable  *godbf.DbfTable
 	updatedAt time.Time
+	notifying int
 	sync.RWMutex
 }
 
-// WeatherRecord represents one weather observation from the weather station
+// WeatherRecord represents one weather observation from the weather station. SeaLevelPressure and AltimeterSetting
+// are derived from AbsolutePressure rather than recorded by the station.
 type WeatherRecord struct {
 	Datetime         time.Time
 	LocalPressure    float64
@@ -42,33 +66,202 @@ type WeatherRecord struct {
 	DewPoint         float64
 	RainSum          float64
 	RelativeHumidity float64
+	SeaLevelPressure float64
+	AltimeterSetting float64
+}
+
+// loaded is closed by the first successful fetch of the DbfTable.
+var (
+	loaded     = make(chan struct{})
+	loadedOnce sync.Once
+)
+
+// refreshHandlers are called, in registration order, after each successful refresh of the cached DbfTable.
+var refreshHandlers []func(table *godbf.DbfTable, first int)
+
+// OnRefresh registers f to be called after each successful refresh of the cached DbfTable. first is the index of
+// the first row that was not present in the previous table, so rows first through NumberOfRecords()-1 are new.
+func OnRefresh(f func(table *godbf.DbfTable, first int)) {
+	refreshHandlers = append(refreshHandlers, f)
+}
+
+// newRecordsBackfill limits how far back the records passed to OnNewRecords handlers reach on the first load.
+const newRecordsBackfill = 24 * time.Hour
+
+// OnNewRecords registers f to be called with the records brought in by each refresh of the cached DbfTable, oldest
+// first and with calibrations applied. The first load passes the records of the last day rather than the whole table.
+func OnNewRecords(f func(records []WeatherRecord)) {
+	OnNewRecordsSince(time.Time{}, f)
+}
+
+// OnNewRecordsSince is like OnNewRecords, but the first load passes the records from since on, so that a handler
+// keeping track of the records it has seen catches up on those recorded while the server was down. A zero since passes
+// the records of the last day.
+func OnNewRecordsSince(since time.Time, f func(records []WeatherRecord)) {
+	OnRefresh(func(table *godbf.DbfTable, first int) {
+		if records := readNewRecords(table, first, since); len(records) > 0 {
+			f(records)
+		}
+	})
+}
+
+// readNewRecords reads the records of table from row first on. When first is 0 it reads those from since on instead,
+// or those of the last day when since is zero.
+func readNewRecords(table *godbf.DbfTable, first int, since time.Time) []WeatherRecord {
+	total := table.NumberOfRecords()
+	if first == 0 && total > 0 {
+		if since.IsZero() {
+			if latest, err := readDatetime(table, total-1); err == nil {
+				since = latest.Add(-newRecordsBackfill)
+			}
+		}
+		first = firstRowFrom(table, total, since)
+	}
+	records := make([]WeatherRecord, 0, total-first)
+	temps := newMeanTemperatures(table, false)
+	for i := first; i < total; i++ {
+		if r := readWeatherRecordFromDbf(table, i, false, temps); r != nil {
+			records = append(records, *r)
+		}
+	}
+	return records
+}
+
+// KeepRefreshed reads the cached DbfTable every interval from a new goroutine, so that it is refreshed and OnRefresh
+// handlers run even while nobody else reads it. Calling the returned function stops it, waiting for a refresh in
+// progress to finish.
+func KeepRefreshed(interval time.Duration) (stop func()) {
+	done, finished := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			getDbf()
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
 }
 
-// getDbf returns a pointer to a dbf table from a constant defined url. On first call it fetches the table, thereafter
-// returns the value from the cached table unless it is stale by 20 minutes or more.
+// Loaded returns a channel that is closed once the DbfTable has been fetched for the first time.
+func Loaded() <-chan struct{} {
+	return loaded
+}
+
+// CacheState describes the cached DbfTable: when it was fetched, when it goes stale and will be fetched again, and the
+// Datetime of its latest record. CalibratedAt is when a calibration was last registered, as that changes the values
+// read from the table too. DetectedAt is when anomalies were last recorded, and Detecting is set while the anomaly
+// detector has yet to finish scoring a refresh, so that the anomalies recorded may change before the table does.
+type CacheState struct {
+	UpdatedAt    time.Time
+	Expires      time.Time
+	Latest       time.Time
+	CalibratedAt time.Time
+	DetectedAt   time.Time
+	Detecting    bool
+}
+
+// ReadCacheState returns the state of the cached DbfTable, refreshing it first if it is stale.
+func ReadCacheState() (CacheState, error) {
+	table, err := getDbf()
+	if err != nil {
+		return CacheState{}, err
+	}
+	cachedDbfTable.RLock()
+	updatedAt, notifying := cachedDbfTable.updatedAt, cachedDbfTable.notifying > 0
+	cachedDbfTable.RUnlock()
+	state := CacheState{UpdatedAt: updatedAt, Expires: updatedAt.Add(CacheTTL), CalibratedAt: CalibrationsChanged()}
+	// A refresh whose handlers are still running may not have been handed to the detector yet.
+	state.DetectedAt, state.Detecting = anomalyState()
+	state.Detecting = state.Detecting || notifying
+	if n := table.NumberOfRecords(); n > 0 {
+		state.Latest, err = readDatetime(table, n-1)
+	}
+	return state, err
+}
+
+// getDbf returns a pointer to a dbf table read from DataURL. On first call it fetches the table, thereafter returns the
+// value from the cached table unless it has been cached for CacheTTL or more.
 func getDbf() (*godbf.DbfTable, error) {
 	var err error
 	table := new(godbf.DbfTable)
 	cachedDbfTable.RLock()
-	needsUpdate := cachedDbfTable.updatedAt.Add(time.Minute*20).Before(time.Now()) || cachedDbfTable.DbfTable == nil
+	needsUpdate := cachedDbfTable.updatedAt.Add(CacheTTL).Before(time.Now()) || cachedDbfTable.DbfTable == nil
 	if !needsUpdate {
 		*table = *cachedDbfTable.DbfTable
 	}
 	cachedDbfTable.RUnlock()
 	if needsUpdate {
 		cachedDbfTable.Lock()
-		//dbfPath := "/Users/pedro/Downloads/chapelco.dbf"
-		dbfPath := "http://googledrive.com/host/0B06ZoNF0o91ncXRPdVRuZjBDaE0"
-		cachedDbfTable.DbfTable, err = godbf.NewFromUrl(dbfPath, "UTF8")
+		var fetched *godbf.DbfTable
+		if strings.HasPrefix(DataURL, "http://") || strings.HasPrefix(DataURL, "https://") {
+			fetched, err = fetchDbf(DataURL, DataEncoding)
+		} else {
+			fetched, err = godbf.NewFromFile(DataURL, DataEncoding)
+		}
+		if err != nil {
+			cachedDbfTable.Unlock()
+			return nil, err
+		}
+		first := 0
+		if cachedDbfTable.DbfTable != nil && cachedDbfTable.DbfTable.NumberOfRecords() <= fetched.NumberOfRecords() {
+			first = cachedDbfTable.DbfTable.NumberOfRecords()
+		}
+		cachedDbfTable.DbfTable = fetched
 		cachedDbfTable.updatedAt = time.Now()
+		cachedDbfTable.notifying++
 		*table = *cachedDbfTable.DbfTable
 		cachedDbfTable.Unlock()
+		loadedOnce.Do(func() { close(loaded) })
+		for _, f := range refreshHandlers {
+			f(table, first)
+		}
+		cachedDbfTable.Lock()
+		cachedDbfTable.notifying--
+		cachedDbfTable.Unlock()
 	}
 	return table, err
 }
 
-// ReadWeatherRecordFromDbf reads a single WeatherRecord from the given Dbf Table.
+// fetchDbf downloads the DBF file at url, giving up after FetchTimeout.
+func fetchDbf(url, encoding string) (*godbf.DbfTable, error) {
+	client := &http.Client{Timeout: FetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("weather: fetching the DBF file: " + resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return godbf.NewFromBytes(data, encoding)
+}
+
+// ReadWeatherRecordFromDbf reads a single WeatherRecord from the given Dbf Table with calibrations applied.
 func ReadWeatherRecordFromDbf(table *godbf.DbfTable, n int) *WeatherRecord {
+	return readWeatherRecordFromDbf(table, n, false, nil)
+}
+
+// ReadRawWeatherRecordFromDbf reads a single WeatherRecord from the given Dbf Table as the logger recorded it.
+func ReadRawWeatherRecordFromDbf(table *godbf.DbfTable, n int) *WeatherRecord {
+	return readWeatherRecordFromDbf(table, n, true, nil)
+}
+
+// readWeatherRecordFromDbf reads a single WeatherRecord, applying calibrations unless raw is set. temps, when not nil,
+// is shared by the reads of a list of records.
+func readWeatherRecordFromDbf(table *godbf.DbfTable, n int, raw bool, temps *meanTemperatures) *WeatherRecord {
 	var err1, err2, err3, err4, err5, err6, err7 error
 	record := new(WeatherRecord)
 	record.RainSum, err1 = table.Float64FieldValueByName(n, rainSum)
@@ -77,25 +270,60 @@ func ReadWeatherRecordFromDbf(table *godbf.DbfTable, n int) *WeatherRecord {
 	record.Temperature, err4 = table.Float64FieldValueByName(n, chn1Deg)
 	record.DewPoint, err5 = table.Float64FieldValueByName(n, chn1Dew)
 	record.RelativeHumidity, err6 = table.Float64FieldValueByName(n, chn1Rf)
-	var minutes float64
-	minutes, err7 = table.Float64FieldValueByName(n, dateTime)
-	record.Datetime = time.Unix(int64((minutes-25569.0)*86400.0)+60*60*4, 0).UTC()
+	record.Datetime, err7 = readDatetime(table, n)
 	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil || err6 != nil || err7 != nil {
 		return nil
 	}
+	if !raw {
+		record.RainSum = calibrate(rainSum, record.Datetime, record.RainSum)
+		record.LocalPressure = calibrate(presLoc, record.Datetime, record.LocalPressure)
+		record.AbsolutePressure = calibrate(presAbs, record.Datetime, record.AbsolutePressure)
+		record.Temperature = calibrate(chn1Deg, record.Datetime, record.Temperature)
+		record.DewPoint = calibrate(chn1Dew, record.Datetime, record.DewPoint)
+		record.RelativeHumidity = calibrate(chn1Rf, record.Datetime, record.RelativeHumidity)
+	}
+	if temps == nil {
+		temps = newMeanTemperatures(table, raw)
+	}
+	meanTemp, err := temps.read(n)
+	if err != nil {
+		return nil
+	}
+	record.SeaLevelPressure = SeaLevelPressure(record.AbsolutePressure, meanTemp)
+	record.AltimeterSetting = AltimeterSetting(record.AbsolutePressure)
 	return record
 }
 
-// ReadLastNWeatherRecordsFromDbf reads the last n WeatherRecords from the DbfTable
+// readDatetime reads the DATE_TIME of row n, stored by the logger as local days since 1899-12-30 in
+// StationTimezone, as a UTC time.
+func readDatetime(table *godbf.DbfTable, n int) (time.Time, error) {
+	days, err := table.Float64FieldValueByName(n, dateTime)
+	wall := time.Unix(int64((days-25569.0)*86400.0), 0).UTC()
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0,
+		StationTimezone).UTC(), err
+}
+
+// ReadLastNWeatherRecordsFromDbf reads the last n WeatherRecords from the DbfTable with calibrations applied.
 func ReadLastNWeatherRecordsFromDbf(table *godbf.DbfTable, n int) []WeatherRecord {
+	return readLastNWeatherRecordsFromDbf(table, n, false)
+}
+
+// ReadLastNRawWeatherRecordsFromDbf reads the last n WeatherRecords from the DbfTable as the logger recorded them.
+func ReadLastNRawWeatherRecordsFromDbf(table *godbf.DbfTable, n int) []WeatherRecord {
+	return readLastNWeatherRecordsFromDbf(table, n, true)
+}
+
+// readLastNWeatherRecordsFromDbf reads the last n WeatherRecords, applying calibrations unless raw is set.
+func readLastNWeatherRecordsFromDbf(table *godbf.DbfTable, n int, raw bool) []WeatherRecord {
 	total := table.NumberOfRecords()
 	start := total - n
 	if start < 0 {
 		return nil
 	}
 	records := make([]WeatherRecord, n)
+	temps := newMeanTemperatures(table, raw)
 	for i := 0; i < n; i++ {
-		r := ReadWeatherRecordFromDbf(table, i+start)
+		r := readWeatherRecordFromDbf(table, i+start, raw, temps)
 		if r == nil {
 			return nil
 		}
@@ -104,42 +332,65 @@ func ReadLastNWeatherRecordsFromDbf(table *godbf.DbfTable, n int) []WeatherRecor
 	return records
 }
 
-// ReadCurrentWeatherRecord reads the most recent (last 1) WeatherRecord from the DbfTable
-func ReadCurrentWeatherRecord() *WeatherRecord {
+// ReadCurrentWeatherRecord reads the most recent (last 1) WeatherRecord from the DbfTable. Unless raw is set
+// calibrations are applied.
+func ReadCurrentWeatherRecord(raw bool) *WeatherRecord {
 	table, err := getDbf()
 	if err != nil {
 		return nil
 	}
 	n := table.NumberOfRecords() - 1
-	return ReadWeatherRecordFromDbf(table, n)
+	return readWeatherRecordFromDbf(table, n, raw, nil)
 }
 
-// ReadLastNWeatherRecords reads the last n records from the cached DbfTable
-func ReadLastNWeatherRecords(n int) []WeatherRecord {
+// ReadLastNWeatherRecords reads the last n records from the cached DbfTable. Unless raw is set calibrations are
+// applied.
+func ReadLastNWeatherRecords(n int, raw bool) []WeatherRecord {
 	table, err := getDbf()
 	if err != nil {
 		return nil
 	}
-	return ReadLastNWeatherRecordsFromDbf(table, n)
+	return readLastNWeatherRecordsFromDbf(table, clampRows(table, n), raw)
 }
 
-// ReadLastNWeatherRecordsToMap reads the last n records in separate lists into a map with keys from code.
-func ReadLastNWeatherRecordsToMap(n int) map[string]interface{} {
+// ReadLastNWeatherRecordsToMap reads the last n records in separate lists into a map with keys from code. Unless raw
+// is set calibrations are applied.
+func ReadLastNWeatherRecordsToMap(n int, raw bool) map[string]interface{} {
 	table, err := getDbf()
 	if err != nil {
 		return nil
 	}
+	n = clampRows(table, n)
 	fields := make(map[string]interface{})
-	fields[rainSum] = ReadLastNRainSums(table, n)
-	fields[presLoc] = ReadLastNPressures(table, n)
-	fields[presAbs] = ReadLastNAbsPressures(table, n)
-	fields[chn1Deg] = ReadLastNTemperatures(table, n)
-	fields[chn1Dew] = ReadLastNDewPoints(table, n)
-	fields[chn1Rf] = ReadLastNRelativeHumidities(table, n)
+	if raw {
+		for _, field := range []string{rainSum, presLoc, presAbs, chn1Deg, chn1Dew, chn1Rf} {
+			fields[field] = readLastNFromFloat64Field(table, n, field, true)
+		}
+	} else {
+		fields[rainSum] = ReadLastNRainSums(table, n)
+		fields[presLoc] = ReadLastNPressures(table, n)
+		fields[presAbs] = ReadLastNAbsPressures(table, n)
+		fields[chn1Deg] = ReadLastNTemperatures(table, n)
+		fields[chn1Dew] = ReadLastNDewPoints(table, n)
+		fields[chn1Rf] = ReadLastNRelativeHumidities(table, n)
+	}
+	fields[presMsl] = readLastNSeaLevelPressures(table, n, raw)
+	fields[presQnh] = readLastNAltimeterSettings(table, n, raw)
 	fields[dateTime] = ReadLastNDateTimes(table, n)
 	return fields
 }
 
+// clampRows limits n to the number of records in table, so asking for more than there are returns all of them.
+func clampRows(table *godbf.DbfTable, n int) int {
+	if total := table.NumberOfRecords(); n > total {
+		return total
+	}
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
 // ReadLastNRainSums reads the last n RAIN_SUM records
 func ReadLastNRainSums(table *godbf.DbfTable, n int) []float64 {
 	return ReadLastNFromFloat64Field(table, n, rainSum)
@@ -170,8 +421,30 @@ func ReadLastNRelativeHumidities(table *godbf.DbfTable, n int) []float64 {
 	return ReadLastNFromFloat64Field(table, n, chn1Rf)
 }
 
-// ReadLastNFromFloat64Field reads the last n records by field string
+// ReadLastNFromFloat64Field reads the last n records by field string with calibrations applied
 func ReadLastNFromFloat64Field(table *godbf.DbfTable, n int, field string) []float64 {
+	return readLastNFromFloat64Field(table, n, field, false)
+}
+
+// readLastNFromFloat64Field reads the last n records by field string, applying calibrations unless raw is set
+func readLastNFromFloat64Field(table *godbf.DbfTable, n int, field string, raw bool) []float64 {
+	rows := ReadLastNRawFromFloat64Field(table, n, field)
+	if rows == nil || raw || !hasCalibrations(field) {
+		return rows
+	}
+	start := table.NumberOfRecords() - n
+	for i := range rows {
+		t, err := readDatetime(table, i+start)
+		if err != nil {
+			return nil
+		}
+		rows[i] = calibrate(field, t, rows[i])
+	}
+	return rows
+}
+
+// ReadLastNRawFromFloat64Field reads the last n records by field string as the logger recorded them
+func ReadLastNRawFromFloat64Field(table *godbf.DbfTable, n int, field string) []float64 {
 	rows := make([]float64, n)
 	var err error
 	start := table.NumberOfRecords() - n
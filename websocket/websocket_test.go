@@ -0,0 +1,293 @@
+// Copyright 2014 Pedro Rodriguez. All rights reserved.
+// Use of this code is governed by the MIT License
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer serves WebSocket connections with handler, upgrading requests from origins.
+func testServer(t *testing.T, origins []string, handler func(*Conn)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, origins)
+		if err != nil {
+			return
+		}
+		handler(conn)
+	}))
+}
+
+// testClient is the client end of a connection, writing raw frames.
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial performs the opening handshake with srv using the example key of RFC 6455, section 1.3, and returns the
+// response along with the client if it was upgraded.
+func dial(t *testing.T, srv *httptest.Server, header string) (*http.Response, *testClient) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := "GET / HTTP/1.1\r\nHost: " + strings.TrimPrefix(srv.URL, "http://") + "\r\n" +
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n" + header + "\r\n"
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	response, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return response, nil
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return response, &testClient{conn, r}
+}
+
+// writeFrame writes a frame masked as clients must, unless unmasked is set.
+func (c *testClient) writeFrame(t *testing.T, fin bool, opcode byte, payload []byte, unmasked bool) {
+	header := []byte{opcode}
+	if fin {
+		header[0] |= 0x80
+	}
+	maskBit := byte(0x80)
+	if unmasked {
+		maskBit = 0
+	}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, maskBit|byte(n))
+	case n <= 0xffff:
+		header = append(header, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		header = append(append(header, maskBit|127), b[:]...)
+	}
+	masked := append([]byte(nil), payload...)
+	if !unmasked {
+		mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+		header = append(header, mask...)
+		for i := range masked {
+			masked[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(header, masked...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads a frame from the server, which must not be masked.
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		t.Fatalf("server frame header % x is not a final unmasked frame", header)
+	}
+	length := uint64(header[1])
+	switch length {
+	case 126:
+		var b [2]byte
+		io.ReadFull(c.r, b[:])
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		io.ReadFull(c.r, b[:])
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// echo writes back every message it reads, then reports the error that ended the connection.
+func echo(errs chan<- error) func(*Conn) {
+	return func(conn *Conn) {
+		defer conn.Close()
+		for {
+			opcode, message, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := conn.WriteMessage(opcode, message); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	srv := testServer(t, nil, func(conn *Conn) { conn.Close() })
+	defer srv.Close()
+	response, client := dial(t, srv, "")
+	if client == nil {
+		t.Fatalf("handshake answered %s", response.Status)
+	}
+	defer client.conn.Close()
+	if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept %q", accept)
+	}
+	if opcode, payload := client.readFrame(t); opcode != closeMessage || !bytes.Equal(payload, []byte{0x03, 0xe8}) {
+		t.Errorf("Close sent opcode %d with % x, want a normal closure", opcode, payload)
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	srv := testServer(t, []string{"https://example.com"}, func(conn *Conn) { conn.Close() })
+	defer srv.Close()
+	for _, test := range []struct {
+		header string
+		status int
+	}{
+		{"Origin: https://example.com\r\n", http.StatusSwitchingProtocols},
+		{"Origin: " + srv.URL + "\r\n", http.StatusSwitchingProtocols},
+		{"Origin: https://evil.example.com\r\n", http.StatusForbidden},
+		{"Origin: null\r\n", http.StatusForbidden},
+	} {
+		response, client := dial(t, srv, test.header)
+		if client != nil {
+			client.conn.Close()
+		}
+		if response.StatusCode != test.status {
+			t.Errorf("%q answered %s, want %d", test.header, response.Status, test.status)
+		}
+	}
+	response, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain GET answered %s, want 400", response.Status)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	errs := make(chan error, 1)
+	srv := testServer(t, nil, echo(errs))
+	defer srv.Close()
+	_, client := dial(t, srv, "")
+	defer client.conn.Close()
+
+	// Each length form: 7 bit, 16 bit and 64 bit.
+	for _, n := range []int{0, 125, 126, 0xffff, 0x10000} {
+		message := bytes.Repeat([]byte{'x'}, n)
+		client.writeFrame(t, true, BinaryMessage, message, false)
+		if opcode, payload := client.readFrame(t); opcode != BinaryMessage || !bytes.Equal(payload, message) {
+			t.Errorf("echo of %d bytes came back as opcode %d with %d bytes", n, opcode, len(payload))
+		}
+	}
+
+	// A fragmented message with a ping in between, which is answered before the message completes.
+	client.writeFrame(t, false, TextMessage, []byte("Hel"), false)
+	client.writeFrame(t, true, pingMessage, []byte("ping"), false)
+	client.writeFrame(t, false, 0, []byte("lo, "), false)
+	client.writeFrame(t, true, 0, []byte("world"), false)
+	if opcode, payload := client.readFrame(t); opcode != pongMessage || string(payload) != "ping" {
+		t.Errorf("ping answered with opcode %d and %q", opcode, payload)
+	}
+	if opcode, payload := client.readFrame(t); opcode != TextMessage || string(payload) != "Hello, world" {
+		t.Errorf("fragmented message came back as opcode %d with %q", opcode, payload)
+	}
+
+	// The closing handshake echoes the status code and ends ReadMessage with io.EOF.
+	client.writeFrame(t, true, closeMessage, []byte{0x03, 0xe8}, false)
+	if opcode, payload := client.readFrame(t); opcode != closeMessage || !bytes.Equal(payload, []byte{0x03, 0xe8}) {
+		t.Errorf("close answered with opcode %d and % x", opcode, payload)
+	}
+	if err := <-errs; err != io.EOF {
+		t.Errorf("ReadMessage returned %v after the close, want io.EOF", err)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		write func(*testing.T, *testClient)
+		want  string
+	}{
+		{"unmasked", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, TextMessage, []byte("hi"), true)
+		}, "unmasked client frame"},
+		{"reserved bits", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, 0x40|TextMessage, []byte("hi"), false)
+		}, "unexpected reserved bits"},
+		{"continuation first", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, 0, []byte("hi"), false)
+		}, "unexpected continuation frame"},
+		{"interleaved messages", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, false, TextMessage, []byte("hi"), false)
+			c.writeFrame(t, true, TextMessage, []byte("hi"), false)
+		}, "expected continuation frame"},
+		{"frame too big", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, true, BinaryMessage, make([]byte, MaxMessageSize+1), false)
+		}, ErrMessageTooBig.Error()},
+		{"message too big", func(t *testing.T, c *testClient) {
+			c.writeFrame(t, false, BinaryMessage, make([]byte, MaxMessageSize), false)
+			c.writeFrame(t, true, 0, []byte{0}, false)
+		}, ErrMessageTooBig.Error()},
+	} {
+		errs := make(chan error, 1)
+		srv := testServer(t, nil, echo(errs))
+		_, client := dial(t, srv, "")
+		test.write(t, client)
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: ReadMessage returned %v, want %q", test.name, err, test.want)
+		}
+		client.conn.Close()
+		srv.Close()
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	errs := make(chan error, 1)
+	srv := testServer(t, nil, func(conn *Conn) {
+		conn.SetReadTimeout(timeout)
+		echo(errs)(conn)
+	})
+	defer srv.Close()
+	_, client := dial(t, srv, "")
+	defer client.conn.Close()
+
+	// Pongs alone keep the connection open well past the timeout.
+	for i := 0; i < 5; i++ {
+		time.Sleep(timeout / 2)
+		client.writeFrame(t, true, pongMessage, nil, false)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("connection answering only with pongs ended with %v", err)
+	default:
+	}
+	// Silence does not.
+	select {
+	case err := <-errs:
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			t.Errorf("silent connection ended with %v, want a timeout", err)
+		}
+	case <-time.After(5 * timeout):
+		t.Error("silent connection was not timed out")
+	}
+}